@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Principal is "who is calling": filled in by middleware.IsAuthenticated from the verified token
+// (from a login or an OAuth client) or API key. Both kinds of credential end up here, so handlers never need to know which was used.
+type Principal struct {
+	UserID uuid.UUID
+	Role   models.Role
+	// Scopes is nil for a normal login, which may do everything its role allows.
+	// For an API key or an OAuth client token it lists what the credential may do.
+	Scopes []string
+	// APIKeyID is the key used for this request, or uuid.Nil for a login session.
+	APIKeyID uuid.UUID
+	// ClientID is the OAuth client a token from /oauth/token was issued to, or "" otherwise.
+	ClientID string
+	// ServiceAccount is true for machine users, which have no password and only use API keys.
+	ServiceAccount bool
+	// TokenID is the jti of the access token used for this request, "" for an API key.
+	// A login's session is found through it, since the refresh cookie only goes to /api/auth.
+	TokenID string
+}
+
+func (p Principal) IsAdmin() bool {
+	return p.Role == models.RoleAdmin
+}
+
+// HasScope reports whether the credential may be used for scope.
+func (p Principal) HasScope(scope string) bool {
+	if p.Scopes == nil {
+		return true
+	}
+	for _, granted := range p.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ViaAPIKey reports whether the request was authenticated with an API key instead of a login.
+func (p Principal) ViaAPIKey() bool {
+	return p.APIKeyID != uuid.Nil
+}
+
+// ViaOAuthClient reports whether the request carries a token an OAuth client got from /oauth/token.
+func (p Principal) ViaOAuthClient() bool {
+	return p.ClientID != ""
+}
+
+// localsKey is unexported so no other package can overwrite the principal with a plain string key.
+type localsKey struct{}
+
+// SetPrincipal stores the principal for the rest of this request.
+func SetPrincipal(c *fiber.Ctx, principal Principal) {
+	c.Locals(localsKey{}, principal)
+}
+
+// PrincipalFrom returns the principal stored by IsAuthenticated.
+// ok is false on routes that are not behind IsAuthenticated.
+func PrincipalFrom(c *fiber.Ctx) (Principal, bool) {
+	principal, ok := c.Locals(localsKey{}).(Principal)
+	return principal, ok
+}
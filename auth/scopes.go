@@ -0,0 +1,18 @@
+package auth
+
+// Scopes limit what a credential may do. A normal login (JWT from /api/login) has no scope list
+// and may do everything its role allows; an API key only what its scopes name.
+const (
+	ScopeProfileRead   = "profile:read"   // GET /api/me and the user's own record
+	ScopeProfileWrite  = "profile:write"  // update or delete the user's own record
+	ScopeOrdersRead    = "orders:read"    // list and read orders
+	ScopeOrdersWrite   = "orders:write"   // place orders and change their status
+	ScopeProductsWrite = "products:write" // create, update and delete products (admins only)
+	ScopeAdmin         = "admin"          // use the owner's admin role at all (admins only)
+)
+
+// AllScopes lists every scope, e.g. for validating a new API key.
+var AllScopes = []string{ScopeProfileRead, ScopeProfileWrite, ScopeOrdersRead, ScopeOrdersWrite, ScopeProductsWrite, ScopeAdmin}
+
+// AdminScopes can only be granted to credentials of admins.
+var AdminScopes = []string{ScopeProductsWrite, ScopeAdmin}
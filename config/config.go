@@ -0,0 +1,627 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+
+	// REQUIRE_VERIFIED_EMAIL values.
+	VerifyNone   = "none"
+	VerifyOrders = "orders"
+	VerifyLogin  = "login"
+
+	HasherArgon2id = "argon2id"
+	HasherBcrypt   = "bcrypt"
+
+	MailerLog  = "log"
+	MailerSMTP = "smtp"
+
+	// DefaultJWTSecret is only good for local development. Load refuses to start in production with it.
+	DefaultJWTSecret = "secret"
+)
+
+// Config holds every setting the server reads at startup.
+// Values come from (lowest to highest priority): Defaults, the optional config file, environment variables.
+type Config struct {
+	Env               string        // APP_ENV: "development" or "production"
+	Port              string        // PORT
+	DBPath            string        // DB_PATH
+	JWTSecret         string        // JWT_SECRET: only used when JWT_ALG is HS256
+	JWTAlgorithm      string        // JWT_ALG: "HS256", "RS256" or "EdDSA"
+	JWTPrivateKeyFile string        // JWT_PRIVATE_KEY_FILE: PEM private key that signs new tokens (RS256/EdDSA)
+	JWTVerifyKeyFiles []string      // JWT_VERIFY_KEY_FILES: comma-separated PEM keys still accepted, e.g. from before a rotation
+	JWTIssuer         string        // JWT_ISSUER: the "iss" claim we sign and require
+	JWTAudience       string        // JWT_AUDIENCE: the "aud" claim we sign and require
+	AccessTokenTTL    time.Duration // ACCESS_TOKEN_TTL, e.g. "15m"
+	RefreshTokenTTL   time.Duration // REFRESH_TOKEN_TTL, e.g. "7d"
+	RefreshReuseGrace time.Duration // REFRESH_REUSE_GRACE: replay window for a just-rotated refresh token (0 disables)
+	CookieSecure      bool          // COOKIE_SECURE: send cookies over HTTPS only (defaults to true in production)
+	AllowedOrigins    []string      // ALLOWED_ORIGINS: comma-separated origins whose pages may call /api/auth/refresh and /api/auth/logout (defaults to the origin of APP_BASE_URL)
+
+	TokenCleanupInterval  time.Duration // TOKEN_CLEANUP_INTERVAL: how often expired/revoked refresh tokens are purged (0 disables)
+	RevokedTokenRetention time.Duration // REVOKED_TOKEN_RETENTION: how long revoked refresh tokens are kept for reuse detection
+
+	BaseURL              string        // APP_BASE_URL: public URL of the app, used for links in emails
+	PasswordResetTTL     time.Duration // PASSWORD_RESET_TTL: how long a password reset link works
+	PasswordResetPerHour int           // PASSWORD_RESET_PER_HOUR: reset emails sent to one account per hour at most
+	MagicLinkTTL         time.Duration // MAGIC_LINK_TTL: how long an emailed login link works
+	MagicLinkPerHour     int           // MAGIC_LINK_PER_HOUR: login links sent to one account per hour at most
+
+	EmailVerificationTTL time.Duration // EMAIL_VERIFICATION_TTL: how long a verification link works
+	VerificationCooldown time.Duration // EMAIL_VERIFICATION_COOLDOWN: minimum time between two verification emails to one account
+	RequireVerifiedEmail string        // REQUIRE_VERIFIED_EMAIL: "none", "orders" (block placing orders) or "login" (block login)
+
+	TOTPIssuer      string        // TOTP_ISSUER: account name prefix shown in authenticator apps
+	MFAPendingTTL   time.Duration // MFA_PENDING_TTL: how long the "mfa pending" token from login works
+	RequireAdminMFA bool          // REQUIRE_ADMIN_MFA: admins without two-factor authentication only get customer rights
+
+	LoginMaxFailures   int           // LOGIN_MAX_FAILURES: failed logins per account before it is locked
+	LoginIPMaxFailures int           // LOGIN_IP_MAX_FAILURES: failed logins per client IP before it is locked
+	LoginLockout       time.Duration // LOGIN_LOCKOUT: first lockout; it doubles with every further failure
+	LoginMaxLockout    time.Duration // LOGIN_MAX_LOCKOUT: upper limit of one lockout
+	LoginFailureWindow time.Duration // LOGIN_FAILURE_WINDOW: failures are forgotten after this long without a new one
+
+	PasswordHasher        string // PASSWORD_HASHER: "argon2id" or "bcrypt" for new hashes; both always verify
+	PasswordMinLength     int    // PASSWORD_MIN_LENGTH
+	PasswordMaxLength     int    // PASSWORD_MAX_LENGTH
+	BreachedPasswordsFile string // BREACHED_PASSWORDS_FILE: extra breached passwords, plain or SHA-1 (HIBP format) per line
+
+	Mailer       string // MAILER: "log" (development) or "smtp"
+	MailFrom     string // MAIL_FROM: sender address of every email
+	MailFile     string // MAIL_FILE: "log" mailer only; append emails to this file instead of the server log
+	SMTPHost     string // SMTP_HOST
+	SMTPPort     string // SMTP_PORT
+	SMTPUsername string // SMTP_USERNAME: empty disables SMTP AUTH
+	SMTPPassword string // SMTP_PASSWORD
+
+	OIDCIssuer       string   // OIDC_ISSUER: identity provider for "sign in with ..." (empty disables it)
+	OIDCClientID     string   // OIDC_CLIENT_ID
+	OIDCClientSecret string   // OIDC_CLIENT_SECRET: empty for a public client (PKCE only)
+	OIDCRedirectURL  string   // OIDC_REDIRECT_URL: defaults to APP_BASE_URL + /api/oidc/callback
+	OIDCScopes       []string // OIDC_SCOPES: comma-separated, must include "openid"
+}
+
+// App is the loaded configuration. It starts as Defaults() so packages still work before Load runs.
+var App = Defaults()
+
+func Defaults() Config {
+	return Config{
+		Env:               EnvDevelopment,
+		Port:              "8000",
+		DBPath:            "api.db",
+		JWTSecret:         DefaultJWTSecret,
+		JWTAlgorithm:      "HS256",
+		JWTIssuer:         "fiber-api",
+		JWTAudience:       "fiber-api",
+		AccessTokenTTL:    15 * time.Minute,
+		RefreshTokenTTL:   7 * 24 * time.Hour,
+		RefreshReuseGrace: 10 * time.Second,
+		CookieSecure:      false,
+
+		TokenCleanupInterval:  time.Hour,
+		RevokedTokenRetention: 7 * 24 * time.Hour,
+
+		BaseURL:              "http://localhost:8000",
+		PasswordResetTTL:     30 * time.Minute,
+		PasswordResetPerHour: 5,
+		MagicLinkTTL:         15 * time.Minute,
+		MagicLinkPerHour:     5,
+
+		EmailVerificationTTL: 24 * time.Hour,
+		VerificationCooldown: time.Minute,
+		RequireVerifiedEmail: VerifyNone,
+
+		TOTPIssuer:    "fiber-api",
+		MFAPendingTTL: 5 * time.Minute,
+
+		LoginMaxFailures:   5,
+		LoginIPMaxFailures: 20,
+		LoginLockout:       30 * time.Second,
+		LoginMaxLockout:    15 * time.Minute,
+		LoginFailureWindow: 15 * time.Minute,
+
+		PasswordHasher:    HasherArgon2id,
+		PasswordMinLength: 8,
+		PasswordMaxLength: 128,
+
+		Mailer:   MailerLog,
+		MailFrom: "no-reply@localhost",
+		SMTPPort: "587",
+
+		OIDCScopes: []string{"openid", "email", "profile"},
+	}
+}
+
+// IsProduction reports whether we run with APP_ENV=production.
+func (c Config) IsProduction() bool {
+	return c.Env == EnvProduction
+}
+
+// Addr is the address for app.Listen, e.g. ":8000".
+func (c Config) Addr() string {
+	return ":" + c.Port
+}
+
+// Load reads the config file named by CONFIG_FILE (default ".env", skipped if it does not exist),
+// then environment variables, validates the result, and stores it in App.
+func Load() (Config, error) {
+	values := map[string]string{}
+
+	path, explicit := os.LookupEnv("CONFIG_FILE")
+	if !explicit {
+		path = ".env"
+	}
+	if err := readFile(path, values); err != nil {
+		if explicit || !errors.Is(err, os.ErrNotExist) {
+			return Config{}, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+
+	// Environment variables win over the file.
+	for _, key := range []string{"APP_ENV", "PORT", "DB_PATH", "JWT_SECRET", "JWT_ALG", "JWT_PRIVATE_KEY_FILE", "JWT_VERIFY_KEY_FILES", "JWT_ISSUER", "JWT_AUDIENCE", "ACCESS_TOKEN_TTL", "REFRESH_TOKEN_TTL", "REFRESH_REUSE_GRACE", "COOKIE_SECURE", "ALLOWED_ORIGINS", "TOKEN_CLEANUP_INTERVAL", "REVOKED_TOKEN_RETENTION",
+		"APP_BASE_URL", "PASSWORD_RESET_TTL", "PASSWORD_RESET_PER_HOUR", "MAGIC_LINK_TTL", "MAGIC_LINK_PER_HOUR", "EMAIL_VERIFICATION_TTL", "EMAIL_VERIFICATION_COOLDOWN", "REQUIRE_VERIFIED_EMAIL",
+		"TOTP_ISSUER", "MFA_PENDING_TTL", "REQUIRE_ADMIN_MFA",
+		"LOGIN_MAX_FAILURES", "LOGIN_IP_MAX_FAILURES", "LOGIN_LOCKOUT", "LOGIN_MAX_LOCKOUT", "LOGIN_FAILURE_WINDOW",
+		"PASSWORD_HASHER", "PASSWORD_MIN_LENGTH", "PASSWORD_MAX_LENGTH", "BREACHED_PASSWORDS_FILE", "MAILER", "MAIL_FROM", "MAIL_FILE", "SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD",
+		"OIDC_ISSUER", "OIDC_CLIENT_ID", "OIDC_CLIENT_SECRET", "OIDC_REDIRECT_URL", "OIDC_SCOPES"} {
+		if value, ok := os.LookupEnv(key); ok {
+			values[key] = value
+		}
+	}
+
+	cfg, err := build(values)
+	if err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	App = cfg
+	return cfg, nil
+}
+
+func build(values map[string]string) (Config, error) {
+	cfg := Defaults()
+
+	if v, ok := values["APP_ENV"]; ok {
+		cfg.Env = strings.ToLower(strings.TrimSpace(v))
+	}
+	if v, ok := values["PORT"]; ok {
+		cfg.Port = strings.TrimPrefix(strings.TrimSpace(v), ":")
+	}
+	if v, ok := values["DB_PATH"]; ok {
+		cfg.DBPath = v
+	}
+	if v, ok := values["JWT_SECRET"]; ok {
+		cfg.JWTSecret = v
+	}
+	if v, ok := values["JWT_ALG"]; ok {
+		cfg.JWTAlgorithm = strings.TrimSpace(v)
+	}
+	if v, ok := values["JWT_PRIVATE_KEY_FILE"]; ok {
+		cfg.JWTPrivateKeyFile = strings.TrimSpace(v)
+	}
+	if v, ok := values["JWT_VERIFY_KEY_FILES"]; ok {
+		cfg.JWTVerifyKeyFiles = splitList(v)
+	}
+	if v, ok := values["JWT_ISSUER"]; ok {
+		cfg.JWTIssuer = strings.TrimSpace(v)
+	}
+	if v, ok := values["JWT_AUDIENCE"]; ok {
+		cfg.JWTAudience = strings.TrimSpace(v)
+	}
+
+	var err error
+	if v, ok := values["ACCESS_TOKEN_TTL"]; ok {
+		if cfg.AccessTokenTTL, err = parseDuration(v); err != nil {
+			return Config{}, fmt.Errorf("ACCESS_TOKEN_TTL: %w", err)
+		}
+	}
+	if v, ok := values["REFRESH_TOKEN_TTL"]; ok {
+		if cfg.RefreshTokenTTL, err = parseDuration(v); err != nil {
+			return Config{}, fmt.Errorf("REFRESH_TOKEN_TTL: %w", err)
+		}
+	}
+
+	if v, ok := values["REFRESH_REUSE_GRACE"]; ok {
+		if cfg.RefreshReuseGrace, err = parseDuration(v); err != nil {
+			return Config{}, fmt.Errorf("REFRESH_REUSE_GRACE: %w", err)
+		}
+	}
+
+	if v, ok := values["TOKEN_CLEANUP_INTERVAL"]; ok {
+		if cfg.TokenCleanupInterval, err = parseDuration(v); err != nil {
+			return Config{}, fmt.Errorf("TOKEN_CLEANUP_INTERVAL: %w", err)
+		}
+	}
+	if v, ok := values["REVOKED_TOKEN_RETENTION"]; ok {
+		if cfg.RevokedTokenRetention, err = parseDuration(v); err != nil {
+			return Config{}, fmt.Errorf("REVOKED_TOKEN_RETENTION: %w", err)
+		}
+	}
+
+	if v, ok := values["APP_BASE_URL"]; ok {
+		cfg.BaseURL = strings.TrimSuffix(strings.TrimSpace(v), "/")
+	}
+	if v, ok := values["PASSWORD_RESET_TTL"]; ok {
+		if cfg.PasswordResetTTL, err = parseDuration(v); err != nil {
+			return Config{}, fmt.Errorf("PASSWORD_RESET_TTL: %w", err)
+		}
+	}
+	if v, ok := values["PASSWORD_RESET_PER_HOUR"]; ok {
+		if cfg.PasswordResetPerHour, err = strconv.Atoi(strings.TrimSpace(v)); err != nil {
+			return Config{}, fmt.Errorf("PASSWORD_RESET_PER_HOUR: %w", err)
+		}
+	}
+	if v, ok := values["MAGIC_LINK_TTL"]; ok {
+		if cfg.MagicLinkTTL, err = parseDuration(v); err != nil {
+			return Config{}, fmt.Errorf("MAGIC_LINK_TTL: %w", err)
+		}
+	}
+	if v, ok := values["MAGIC_LINK_PER_HOUR"]; ok {
+		if cfg.MagicLinkPerHour, err = strconv.Atoi(strings.TrimSpace(v)); err != nil {
+			return Config{}, fmt.Errorf("MAGIC_LINK_PER_HOUR: %w", err)
+		}
+	}
+	if v, ok := values["EMAIL_VERIFICATION_TTL"]; ok {
+		if cfg.EmailVerificationTTL, err = parseDuration(v); err != nil {
+			return Config{}, fmt.Errorf("EMAIL_VERIFICATION_TTL: %w", err)
+		}
+	}
+	if v, ok := values["EMAIL_VERIFICATION_COOLDOWN"]; ok {
+		if cfg.VerificationCooldown, err = parseDuration(v); err != nil {
+			return Config{}, fmt.Errorf("EMAIL_VERIFICATION_COOLDOWN: %w", err)
+		}
+	}
+	if v, ok := values["REQUIRE_VERIFIED_EMAIL"]; ok {
+		cfg.RequireVerifiedEmail = strings.ToLower(strings.TrimSpace(v))
+	}
+	if v, ok := values["TOTP_ISSUER"]; ok {
+		cfg.TOTPIssuer = strings.TrimSpace(v)
+	}
+	if v, ok := values["MFA_PENDING_TTL"]; ok {
+		if cfg.MFAPendingTTL, err = parseDuration(v); err != nil {
+			return Config{}, fmt.Errorf("MFA_PENDING_TTL: %w", err)
+		}
+	}
+	if v, ok := values["REQUIRE_ADMIN_MFA"]; ok {
+		if cfg.RequireAdminMFA, err = strconv.ParseBool(strings.TrimSpace(v)); err != nil {
+			return Config{}, fmt.Errorf("REQUIRE_ADMIN_MFA: %w", err)
+		}
+	}
+	if v, ok := values["LOGIN_MAX_FAILURES"]; ok {
+		if cfg.LoginMaxFailures, err = strconv.Atoi(strings.TrimSpace(v)); err != nil {
+			return Config{}, fmt.Errorf("LOGIN_MAX_FAILURES: %w", err)
+		}
+	}
+	if v, ok := values["LOGIN_IP_MAX_FAILURES"]; ok {
+		if cfg.LoginIPMaxFailures, err = strconv.Atoi(strings.TrimSpace(v)); err != nil {
+			return Config{}, fmt.Errorf("LOGIN_IP_MAX_FAILURES: %w", err)
+		}
+	}
+	if v, ok := values["LOGIN_LOCKOUT"]; ok {
+		if cfg.LoginLockout, err = parseDuration(v); err != nil {
+			return Config{}, fmt.Errorf("LOGIN_LOCKOUT: %w", err)
+		}
+	}
+	if v, ok := values["LOGIN_MAX_LOCKOUT"]; ok {
+		if cfg.LoginMaxLockout, err = parseDuration(v); err != nil {
+			return Config{}, fmt.Errorf("LOGIN_MAX_LOCKOUT: %w", err)
+		}
+	}
+	if v, ok := values["LOGIN_FAILURE_WINDOW"]; ok {
+		if cfg.LoginFailureWindow, err = parseDuration(v); err != nil {
+			return Config{}, fmt.Errorf("LOGIN_FAILURE_WINDOW: %w", err)
+		}
+	}
+	if v, ok := values["PASSWORD_HASHER"]; ok {
+		cfg.PasswordHasher = strings.ToLower(strings.TrimSpace(v))
+	}
+	if v, ok := values["PASSWORD_MIN_LENGTH"]; ok {
+		if cfg.PasswordMinLength, err = strconv.Atoi(strings.TrimSpace(v)); err != nil {
+			return Config{}, fmt.Errorf("PASSWORD_MIN_LENGTH: %w", err)
+		}
+	}
+	if v, ok := values["PASSWORD_MAX_LENGTH"]; ok {
+		if cfg.PasswordMaxLength, err = strconv.Atoi(strings.TrimSpace(v)); err != nil {
+			return Config{}, fmt.Errorf("PASSWORD_MAX_LENGTH: %w", err)
+		}
+	}
+	if v, ok := values["BREACHED_PASSWORDS_FILE"]; ok {
+		cfg.BreachedPasswordsFile = strings.TrimSpace(v)
+	}
+	if v, ok := values["MAILER"]; ok {
+		cfg.Mailer = strings.ToLower(strings.TrimSpace(v))
+	}
+	if v, ok := values["MAIL_FROM"]; ok {
+		cfg.MailFrom = strings.TrimSpace(v)
+	}
+	if v, ok := values["MAIL_FILE"]; ok {
+		cfg.MailFile = strings.TrimSpace(v)
+	}
+	if v, ok := values["SMTP_HOST"]; ok {
+		cfg.SMTPHost = strings.TrimSpace(v)
+	}
+	if v, ok := values["SMTP_PORT"]; ok {
+		cfg.SMTPPort = strings.TrimSpace(v)
+	}
+	if v, ok := values["SMTP_USERNAME"]; ok {
+		cfg.SMTPUsername = v
+	}
+	if v, ok := values["SMTP_PASSWORD"]; ok {
+		cfg.SMTPPassword = v
+	}
+	if v, ok := values["OIDC_ISSUER"]; ok {
+		cfg.OIDCIssuer = strings.TrimSuffix(strings.TrimSpace(v), "/")
+	}
+	if v, ok := values["OIDC_CLIENT_ID"]; ok {
+		cfg.OIDCClientID = strings.TrimSpace(v)
+	}
+	if v, ok := values["OIDC_CLIENT_SECRET"]; ok {
+		cfg.OIDCClientSecret = v
+	}
+	// The redirect URL follows APP_BASE_URL unless set explicitly.
+	cfg.OIDCRedirectURL = cfg.BaseURL + "/api/oidc/callback"
+	if v, ok := values["OIDC_REDIRECT_URL"]; ok {
+		cfg.OIDCRedirectURL = strings.TrimSpace(v)
+	}
+	if v, ok := values["OIDC_SCOPES"]; ok {
+		cfg.OIDCScopes = splitList(v)
+	}
+
+	// Secure cookies follow the environment unless set explicitly.
+	cfg.CookieSecure = cfg.IsProduction()
+	if v, ok := values["COOKIE_SECURE"]; ok {
+		if cfg.CookieSecure, err = strconv.ParseBool(strings.TrimSpace(v)); err != nil {
+			return Config{}, fmt.Errorf("COOKIE_SECURE: %w", err)
+		}
+	}
+
+	// So do the origins trusted to send the refresh cookie.
+	cfg.AllowedOrigins = []string{originOf(cfg.BaseURL)}
+	if v, ok := values["ALLOWED_ORIGINS"]; ok {
+		cfg.AllowedOrigins = nil
+		for _, origin := range splitList(v) {
+			cfg.AllowedOrigins = append(cfg.AllowedOrigins, strings.ToLower(strings.TrimSuffix(origin, "/")))
+		}
+	}
+
+	return cfg, nil
+}
+
+// originOf returns the origin ("scheme://host[:port]", lower case) of a URL, or "" if it has none.
+func originOf(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return ""
+	}
+	return strings.ToLower(parsed.Scheme + "://" + parsed.Host)
+}
+
+// Validate checks the settings the server cannot run safely without.
+func (c Config) Validate() error {
+	var problems []string
+
+	if c.Env != EnvDevelopment && c.Env != EnvProduction {
+		problems = append(problems, fmt.Sprintf("APP_ENV must be %q or %q, got %q", EnvDevelopment, EnvProduction, c.Env))
+	}
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("PORT must be a number between 1 and 65535, got %q", c.Port))
+	}
+	if strings.TrimSpace(c.DBPath) == "" {
+		problems = append(problems, "DB_PATH must not be empty")
+	}
+	switch c.JWTAlgorithm {
+	case "HS256":
+		if c.JWTSecret == "" {
+			problems = append(problems, "JWT_SECRET must not be empty")
+		}
+	case "RS256", "EdDSA":
+	default:
+		problems = append(problems, fmt.Sprintf("JWT_ALG must be HS256, RS256 or EdDSA, got %q", c.JWTAlgorithm))
+	}
+	if c.JWTIssuer == "" || c.JWTAudience == "" {
+		problems = append(problems, "JWT_ISSUER and JWT_AUDIENCE must not be empty")
+	}
+	if c.AccessTokenTTL <= 0 || c.RefreshTokenTTL <= 0 {
+		problems = append(problems, "ACCESS_TOKEN_TTL and REFRESH_TOKEN_TTL must be positive")
+	}
+	if c.AccessTokenTTL >= c.RefreshTokenTTL {
+		problems = append(problems, "ACCESS_TOKEN_TTL must be shorter than REFRESH_TOKEN_TTL")
+	}
+	if c.RefreshReuseGrace < 0 || c.RefreshReuseGrace > time.Minute {
+		problems = append(problems, "REFRESH_REUSE_GRACE must be between 0 and 1m")
+	}
+	if c.TokenCleanupInterval < 0 {
+		problems = append(problems, "TOKEN_CLEANUP_INTERVAL must not be negative")
+	} else if c.TokenCleanupInterval > 0 && c.TokenCleanupInterval < time.Second {
+		problems = append(problems, "TOKEN_CLEANUP_INTERVAL must be at least 1s")
+	}
+	// Rotated tokens must outlive the grace window, or a harmless refresh race would look like an unknown token.
+	if c.RevokedTokenRetention < c.RefreshReuseGrace {
+		problems = append(problems, "REVOKED_TOKEN_RETENTION must not be shorter than REFRESH_REUSE_GRACE")
+	}
+	if !strings.HasPrefix(c.BaseURL, "http://") && !strings.HasPrefix(c.BaseURL, "https://") {
+		problems = append(problems, fmt.Sprintf("APP_BASE_URL must start with http:// or https://, got %q", c.BaseURL))
+	}
+	if len(c.AllowedOrigins) == 0 {
+		problems = append(problems, "ALLOWED_ORIGINS must name at least one origin")
+	}
+	for _, origin := range c.AllowedOrigins {
+		// An origin has no path, query or trailing slash, e.g. https://shop.example.com or http://localhost:3000.
+		if originOf(origin) != origin || (!strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://")) {
+			problems = append(problems, fmt.Sprintf("ALLOWED_ORIGINS entries must look like https://host[:port], got %q", origin))
+		}
+	}
+	if c.PasswordResetTTL <= 0 || c.PasswordResetTTL > 24*time.Hour {
+		problems = append(problems, "PASSWORD_RESET_TTL must be between 0 and 24h")
+	}
+	if c.PasswordResetPerHour < 1 {
+		problems = append(problems, "PASSWORD_RESET_PER_HOUR must be at least 1")
+	}
+	if c.MagicLinkTTL <= 0 || c.MagicLinkTTL > time.Hour {
+		problems = append(problems, "MAGIC_LINK_TTL must be between 0 and 1h")
+	}
+	if c.MagicLinkPerHour < 1 {
+		problems = append(problems, "MAGIC_LINK_PER_HOUR must be at least 1")
+	}
+	if c.EmailVerificationTTL <= 0 {
+		problems = append(problems, "EMAIL_VERIFICATION_TTL must be positive")
+	}
+	if c.VerificationCooldown < 0 || c.VerificationCooldown >= c.EmailVerificationTTL {
+		problems = append(problems, "EMAIL_VERIFICATION_COOLDOWN must be between 0 and EMAIL_VERIFICATION_TTL")
+	}
+	switch c.RequireVerifiedEmail {
+	case VerifyNone, VerifyOrders, VerifyLogin:
+	default:
+		problems = append(problems, fmt.Sprintf("REQUIRE_VERIFIED_EMAIL must be %q, %q or %q, got %q", VerifyNone, VerifyOrders, VerifyLogin, c.RequireVerifiedEmail))
+	}
+	if c.TOTPIssuer == "" || strings.Contains(c.TOTPIssuer, ":") {
+		problems = append(problems, "TOTP_ISSUER must not be empty or contain ':'")
+	}
+	if c.MFAPendingTTL <= 0 || c.MFAPendingTTL > 15*time.Minute {
+		problems = append(problems, "MFA_PENDING_TTL must be between 0 and 15m")
+	}
+	if c.LoginMaxFailures < 1 || c.LoginIPMaxFailures < 1 {
+		problems = append(problems, "LOGIN_MAX_FAILURES and LOGIN_IP_MAX_FAILURES must be at least 1")
+	}
+	if c.LoginLockout <= 0 || c.LoginMaxLockout < c.LoginLockout {
+		problems = append(problems, "LOGIN_LOCKOUT must be positive and not longer than LOGIN_MAX_LOCKOUT")
+	}
+	if c.LoginFailureWindow <= 0 {
+		problems = append(problems, "LOGIN_FAILURE_WINDOW must be positive")
+	}
+	if c.PasswordHasher != HasherArgon2id && c.PasswordHasher != HasherBcrypt {
+		problems = append(problems, fmt.Sprintf("PASSWORD_HASHER must be %q or %q, got %q", HasherArgon2id, HasherBcrypt, c.PasswordHasher))
+	}
+	if c.PasswordMinLength < 1 || c.PasswordMaxLength < c.PasswordMinLength {
+		problems = append(problems, "PASSWORD_MIN_LENGTH must be at least 1 and not above PASSWORD_MAX_LENGTH")
+	}
+	if c.IsProduction() && c.PasswordMinLength < 8 {
+		problems = append(problems, "PASSWORD_MIN_LENGTH must be at least 8 in production")
+	}
+	if c.MailFrom == "" {
+		problems = append(problems, "MAIL_FROM must not be empty")
+	}
+	switch c.Mailer {
+	case MailerLog:
+	case MailerSMTP:
+		if c.SMTPHost == "" {
+			problems = append(problems, "SMTP_HOST is required when MAILER is smtp")
+		}
+		if port, err := strconv.Atoi(c.SMTPPort); err != nil || port < 1 || port > 65535 {
+			problems = append(problems, fmt.Sprintf("SMTP_PORT must be a number between 1 and 65535, got %q", c.SMTPPort))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("MAILER must be %q or %q, got %q", MailerLog, MailerSMTP, c.Mailer))
+	}
+
+	if c.OIDCIssuer != "" {
+		// Discovery and the token exchange must not run over plain HTTP, except against a
+		// provider on this machine during development.
+		local := strings.HasPrefix(c.OIDCIssuer, "http://localhost") || strings.HasPrefix(c.OIDCIssuer, "http://127.0.0.1")
+		if !strings.HasPrefix(c.OIDCIssuer, "https://") && (c.IsProduction() || !local) {
+			problems = append(problems, fmt.Sprintf("OIDC_ISSUER must start with https://, got %q", c.OIDCIssuer))
+		}
+		if c.OIDCClientID == "" {
+			problems = append(problems, "OIDC_CLIENT_ID is required when OIDC_ISSUER is set")
+		}
+		if !strings.HasPrefix(c.OIDCRedirectURL, "http://") && !strings.HasPrefix(c.OIDCRedirectURL, "https://") {
+			problems = append(problems, fmt.Sprintf("OIDC_REDIRECT_URL must start with http:// or https://, got %q", c.OIDCRedirectURL))
+		}
+		if !slices.Contains(c.OIDCScopes, "openid") {
+			problems = append(problems, "OIDC_SCOPES must include openid")
+		}
+	}
+
+	if c.IsProduction() {
+		if c.JWTAlgorithm == "HS256" {
+			if c.JWTSecret == DefaultJWTSecret {
+				problems = append(problems, "JWT_SECRET must be changed from the default in production")
+			} else if len(c.JWTSecret) < 32 {
+				problems = append(problems, "JWT_SECRET must be at least 32 characters in production")
+			}
+		} else if c.JWTPrivateKeyFile == "" {
+			problems = append(problems, "JWT_PRIVATE_KEY_FILE is required in production when JWT_ALG is "+c.JWTAlgorithm)
+		}
+		if !c.CookieSecure {
+			problems = append(problems, "COOKIE_SECURE cannot be false in production")
+		}
+		// The log mailer writes reset links in clear text where anyone reading the logs can use them.
+		if c.Mailer != MailerSMTP {
+			problems = append(problems, "MAILER must be smtp in production")
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// splitList splits a comma-separated value and drops empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseDuration accepts everything time.ParseDuration does, plus whole days like "7d".
+func parseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if days, found := strings.CutSuffix(value, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// readFile reads simple KEY=VALUE lines. Blank lines and lines starting with # are ignored,
+// and values may be wrapped in single or double quotes.
+func readFile(path string, values map[string]string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return fmt.Errorf("line %d: expected KEY=VALUE", lineNumber)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	return scanner.Err()
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 
+	"github.com/amanguptak/fiber-api/config"
 	"github.com/amanguptak/fiber-api/models"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -17,7 +18,10 @@ type DbInstance struct {
 var Database DbInstance
 
 func ConnectDb() {
-	db, err := gorm.Open(sqlite.Open("api.db"), &gorm.Config{})
+	// _txlock=immediate makes every transaction take the write lock at BEGIN, and _busy_timeout makes
+	// other writers wait for it instead of failing with "database is locked".
+	// Without these, two concurrent transactions can both read and then deadlock when upgrading to write.
+	db, err := gorm.Open(sqlite.Open(config.App.DBPath+"?_txlock=immediate&_busy_timeout=5000"), &gorm.Config{})
 
 	if err != nil {
 		log.Fatal("failed to connect with database ! \n", err.Error())
@@ -28,11 +32,25 @@ func ConnectDb() {
 	log.Println("Running Migration")
 	//Add Migration
 
-	err = db.AutoMigrate(&models.User{}, &models.Product{}, &models.Order{}, &models.RefreshToken{})
+	tables := []interface{}{&models.User{}, &models.Product{}, &models.Order{}, &models.OrderItem{}, &models.OrderStatusChange{}, &models.RefreshToken{}, &models.TokenReuseEvent{}, &models.RevokedAccessToken{}, &models.PasswordResetToken{}, &models.EmailVerificationToken{}, &models.TOTPCredential{}, &models.RecoveryCode{}, &models.LoginThrottle{}, &models.APIKey{}, &models.OIDCLoginState{}, &models.ExternalIdentity{}, &models.OAuthClient{}, &models.MagicLinkToken{}}
+
+	err = db.AutoMigrate(tables...)
 	if err != nil {
 		log.Fatal("Migration Failed: " + err.Error())
 		os.Exit(2)
 	}
 
+	if err = migrateLegacyData(db); err != nil {
+		log.Fatal("Migration Failed: " + err.Error())
+		os.Exit(2)
+	}
+
+	// SQLite drops a column by rebuilding the table, which loses its indexes.
+	// A second AutoMigrate puts back anything the data migrations removed.
+	if err = db.AutoMigrate(tables...); err != nil {
+		log.Fatal("Migration Failed: " + err.Error())
+		os.Exit(2)
+	}
+
 	Database = DbInstance{Db: db}
 }
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AutoMigrate only adds tables and columns, it never moves data or drops anything.
+// The functions in this file handle the schema changes that AutoMigrate cannot do on its own.
+// Each one checks the current schema first, so running them on every start is safe.
+
+// migrateLegacyData runs every data migration in order. Money columns come first,
+// because the single-product order migration reads prices from the new columns.
+func migrateLegacyData(db *gorm.DB) error {
+	steps := []func(*gorm.DB) error{
+		migrateProductMoneyAndStock,
+		migrateOrderMoney,
+		migrateSingleProductOrders,
+		migrateRefreshTokenFamilies,
+	}
+
+	for _, step := range steps {
+		if err := step(db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateProductMoneyAndStock converts the old decimal price strings on products to Money
+// and moves the text quantity column into the integer stock column.
+func migrateProductMoneyAndStock(db *gorm.DB) error {
+	if err := migrateDecimalMoneyColumn(db, "products", "price"); err != nil {
+		return err
+	}
+
+	if !db.Migrator().HasColumn(&models.Product{}, "quantity") {
+		return nil
+	}
+
+	type legacyProduct struct {
+		ID       uuid.UUID
+		Quantity string
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var rows []legacyProduct
+		if err := tx.Table("products").Select("id, quantity").Scan(&rows).Error; err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			stock := 0
+			if quantity := strings.TrimSpace(row.Quantity); quantity != "" {
+				var err error
+				if stock, err = strconv.Atoi(quantity); err != nil {
+					return fmt.Errorf("product %s: invalid quantity %q", row.ID, row.Quantity)
+				}
+			}
+			if err := tx.Table("products").Where("id = ?", row.ID).Update("stock", stock).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Migrator().DropColumn(&models.Product{}, "quantity")
+	})
+}
+
+// migrateOrderMoney converts the decimal total/unit_price strings written before Money existed.
+func migrateOrderMoney(db *gorm.DB) error {
+	if err := migrateDecimalMoneyColumn(db, "orders", "total"); err != nil {
+		return err
+	}
+	return migrateDecimalMoneyColumn(db, "order_items", "unit_price")
+}
+
+// migrateDecimalMoneyColumn rewrites plain decimals like "19.99" into the Money format ("1999 USD"),
+// using DefaultCurrency. Values already in the Money format contain a space and are left alone.
+func migrateDecimalMoneyColumn(db *gorm.DB, table string, column string) error {
+	type legacyRow struct {
+		ID    uuid.UUID
+		Value string
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var rows []legacyRow
+		if err := tx.Table(table).Select("id, " + column + " AS value").
+			Where(column + " IS NOT NULL AND " + column + " <> '' AND " + column + " NOT LIKE '% %'").
+			Scan(&rows).Error; err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			money, err := models.ParseMoney(row.Value, models.DefaultCurrency)
+			if err != nil {
+				return fmt.Errorf("%s %s: %w", table, row.ID, err)
+			}
+
+			if err := tx.Table(table).Where("id = ?", row.ID).Update(column, money).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// migrateSingleProductOrders moves orders created before OrderItem existed
+// (one product_id column on the order) into a single order_items row each.
+func migrateSingleProductOrders(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.Order{}, "product_id") {
+		return nil
+	}
+
+	type legacyOrder struct {
+		ID        uuid.UUID
+		CreatedAt time.Time
+		ProductID uuid.UUID
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var legacyOrders []legacyOrder
+		if err := tx.Table("orders").Select("id, created_at, product_id").
+			Where("product_id IS NOT NULL").Scan(&legacyOrders).Error; err != nil {
+			return err
+		}
+
+		for _, legacy := range legacyOrders {
+			var product models.Product
+			tx.Find(&product, "id = ?", legacy.ProductID)
+
+			item := models.OrderItem{
+				CreatedAt:   legacy.CreatedAt,
+				OrderID:     legacy.ID,
+				ProductID:   legacy.ProductID,
+				ProductName: product.Name,
+				Quantity:    1,
+				UnitPrice:   product.Price,
+			}
+			if err := tx.Create(&item).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Order{}).Where("id = ?", legacy.ID).
+				Updates(models.Order{Total: product.Price}).Error; err != nil {
+				return err
+			}
+		}
+
+		if tx.Migrator().HasConstraint(&models.Order{}, "fk_orders_product") {
+			if err := tx.Migrator().DropConstraint(&models.Order{}, "fk_orders_product"); err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().DropColumn(&models.Order{}, "product_id")
+	})
+}
+
+// migrateRefreshTokenFamilies puts every refresh token stored before families existed into
+// a family of its own, so reuse detection never groups unrelated old logins together.
+func migrateRefreshTokenFamilies(db *gorm.DB) error {
+	return db.Model(&models.RefreshToken{}).
+		Where("family_id IS NULL OR family_id = ?", uuid.Nil).
+		Update("family_id", gorm.Expr("id")).Error
+}
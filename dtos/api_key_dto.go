@@ -0,0 +1,50 @@
+package dtos
+
+import (
+	"time"
+
+	"github.com/amanguptak/fiber-api/models"
+)
+
+type CreateAPIKey struct {
+	Name   string   `json:"name" validate:"required,min=2,max=64"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=profile:read profile:write orders:read orders:write products:write admin"`
+	// 0 or missing: the key never expires.
+	ExpiresInDays int `json:"expiresInDays" validate:"min=0,max=3650"`
+}
+
+type CreateServiceAccount struct {
+	Name string `json:"name" validate:"required,min=2,max=32"`
+	Role string `json:"role" validate:"required,oneof=admin customer"`
+}
+
+// APIKey describes a key without the key itself, which is never stored.
+type APIKey struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // the start of the key, to recognise it
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+}
+
+// CreatedAPIKey is only returned by the create endpoints: Key is shown this one time.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+func CreateResponseAPIKey(key models.APIKey) APIKey {
+	return APIKey{
+		Id:         key.ID.String(),
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.ScopeList(),
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+	}
+}
@@ -0,0 +1,44 @@
+package dtos
+
+import (
+	"time"
+
+	"github.com/amanguptak/fiber-api/jobs"
+)
+
+// JobStatus reports how a background job's last run went.
+type JobStatus struct {
+	Name           string     `json:"name"`
+	Interval       string     `json:"interval"`
+	Running        bool       `json:"running"`
+	Runs           int        `json:"runs"`
+	LastStartedAt  *time.Time `json:"lastStartedAt,omitempty"`
+	LastFinishedAt *time.Time `json:"lastFinishedAt,omitempty"`
+	LastDuration   string     `json:"lastDuration,omitempty"`
+	LastResult     string     `json:"lastResult,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	NextRunAt      *time.Time `json:"nextRunAt,omitempty"`
+}
+
+func CreateResponseJobStatus(status jobs.Status) JobStatus {
+	response := JobStatus{
+		Name:       status.Name,
+		Interval:   status.Interval.String(),
+		Running:    status.Running,
+		Runs:       status.Runs,
+		LastResult: status.LastResult,
+		LastError:  status.LastError,
+	}
+	// Zero times mean "never", so leave them out instead of sending 0001-01-01.
+	if !status.LastStartedAt.IsZero() {
+		response.LastStartedAt = &status.LastStartedAt
+	}
+	if !status.LastFinishedAt.IsZero() {
+		response.LastFinishedAt = &status.LastFinishedAt
+		response.LastDuration = status.LastDuration.String()
+	}
+	if !status.NextRunAt.IsZero() {
+		response.NextRunAt = &status.NextRunAt
+	}
+	return response
+}
@@ -0,0 +1,67 @@
+package dtos
+
+import (
+	"time"
+
+	"github.com/amanguptak/fiber-api/models"
+)
+
+type CreateOAuthClient struct {
+	Name   string   `json:"name" validate:"required,min=2,max=32"`
+	Role   string   `json:"role" validate:"required,oneof=admin customer"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=profile:read profile:write orders:read orders:write products:write admin"`
+}
+
+// OAuthClient describes a registered client without its secret, which is never stored.
+type OAuthClient struct {
+	Id        string     `json:"id"`
+	ClientId  string     `json:"clientId"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	UserId    string     `json:"userId"` // the service account the client acts as
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt"`
+}
+
+// CreatedOAuthClient is only returned when registering: ClientSecret is shown this one time.
+type CreatedOAuthClient struct {
+	OAuthClient
+	ClientSecret string `json:"clientSecret"`
+}
+
+func CreateResponseOAuthClient(client models.OAuthClient) OAuthClient {
+	return OAuthClient{
+		Id:        client.ID.String(),
+		ClientId:  client.ClientID,
+		Name:      client.Name,
+		Scopes:    client.ScopeList(),
+		UserId:    client.UserID.String(),
+		CreatedAt: client.CreatedAt,
+		RevokedAt: client.RevokedAt,
+	}
+}
+
+// TokenResponse is the successful /oauth/token response (RFC 6749 section 5.1).
+// Field names follow the RFC, not our usual camelCase.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// Introspection is the /oauth/introspect response (RFC 7662 section 2.2). An inactive token
+// gets only {"active": false}, so nothing is revealed about why.
+type Introspection struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientId  string   `json:"client_id,omitempty"`
+	TokenType string   `json:"token_type,omitempty"` // "access_token" or "refresh_token"
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	Sub       string   `json:"sub,omitempty"`
+	Aud       []string `json:"aud,omitempty"`
+	Iss       string   `json:"iss,omitempty"`
+	Jti       string   `json:"jti,omitempty"`
+}
@@ -0,0 +1,85 @@
+package dtos
+
+import (
+	"time"
+
+	"github.com/amanguptak/fiber-api/models"
+)
+
+// CreateOrder only carries the basket. The buyer is taken from the JWT, never from the body,
+// so a caller cannot place orders on behalf of someone else. Prices are never accepted either;
+// the server looks them up and computes the total itself.
+type CreateOrder struct {
+	Items []CreateOrderItem `json:"items" validate:"required,min=1,dive"`
+}
+
+type CreateOrderItem struct {
+	ProductId string `json:"productId" validate:"required,uuid"`
+	Quantity  int    `json:"quantity" validate:"required,min=1,max=1000"`
+}
+
+type UpdateOrderStatus struct {
+	Status string `json:"status" validate:"required,oneof=pending paid fulfilled shipped delivered cancelled refunded"`
+}
+
+type OrderItem struct {
+	Id          string       `json:"id"`
+	ProductId   string       `json:"productId"`
+	ProductName string       `json:"productName"`
+	Quantity    int          `json:"quantity"`
+	UnitPrice   models.Money `json:"unitPrice"`
+}
+
+type Order struct {
+	Id        string              `json:"id"`
+	UserId    string              `json:"userId"`
+	Items     []OrderItem         `json:"items"`
+	Total     models.Money        `json:"total"`
+	Status    string              `json:"status"`
+	History   []OrderStatusChange `json:"history"`
+	CreatedAt time.Time           `json:"createdAt"`
+}
+
+type OrderStatusChange struct {
+	From      string    `json:"from,omitempty"`
+	To        string    `json:"to"`
+	ChangedBy string    `json:"changedBy"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+func CreateResponseOrderItem(item models.OrderItem) OrderItem {
+	return OrderItem{
+		Id:          item.ID.String(),
+		ProductId:   item.ProductID.String(),
+		ProductName: item.ProductName,
+		Quantity:    item.Quantity,
+		UnitPrice:   item.UnitPrice,
+	}
+}
+
+func CreateResponseOrder(order models.Order) Order {
+	items := make([]OrderItem, 0, len(order.Items))
+	for _, item := range order.Items {
+		items = append(items, CreateResponseOrderItem(item))
+	}
+
+	history := make([]OrderStatusChange, 0, len(order.StatusHistory))
+	for _, change := range order.StatusHistory {
+		history = append(history, OrderStatusChange{
+			From:      string(change.FromStatus),
+			To:        string(change.ToStatus),
+			ChangedBy: change.ChangedByID.String(),
+			ChangedAt: change.CreatedAt,
+		})
+	}
+
+	return Order{
+		Id:        order.ID.String(),
+		UserId:    order.UserID.String(),
+		Items:     items,
+		Total:     order.Total,
+		Status:    string(order.Status),
+		History:   history,
+		CreatedAt: order.CreatedAt,
+	}
+}
@@ -0,0 +1,38 @@
+package dtos
+
+import "github.com/amanguptak/fiber-api/models"
+
+// Product is the public shape of a catalog entry.
+// Like dtos.User it keeps the GORM model out of our JSON responses.
+type Product struct {
+	Id    string       `json:"id"`
+	Name  string       `json:"name"`
+	Price models.Money `json:"price"`
+	Stock int          `json:"stock"`
+}
+
+// CreateProduct takes the price in minor units (cents), e.g. 1999 + "USD" for 19.99 USD.
+// Price is a pointer so a missing price is an error, while 0 (a free product) stays possible.
+type CreateProduct struct {
+	Name     string `json:"name" validate:"required,min=2,max=64"`
+	Price    *int64 `json:"price" validate:"required,min=0"`
+	Currency string `json:"currency" validate:"required,iso4217"`
+	Stock    int    `json:"stock" validate:"min=0"`
+}
+
+// UpdateProduct uses pointers so PATCH can tell "not sent" apart from "sent empty".
+type UpdateProduct struct {
+	Name     *string `json:"name" validate:"omitempty,min=2,max=64"`
+	Price    *int64  `json:"price" validate:"omitempty,min=0"`
+	Currency *string `json:"currency" validate:"omitempty,iso4217"`
+	Stock    *int    `json:"stock" validate:"omitempty,min=0"`
+}
+
+func CreateResponseProduct(product models.Product) Product {
+	return Product{
+		Id:    product.ID.String(),
+		Name:  product.Name,
+		Price: product.Price,
+		Stock: product.Stock,
+	}
+}
@@ -0,0 +1,31 @@
+package dtos
+
+import (
+	"time"
+
+	"github.com/amanguptak/fiber-api/repositories"
+	"github.com/google/uuid"
+)
+
+// Session is one active login as shown to the user: where and when it was used, never the token itself.
+type Session struct {
+	Id         string    `json:"id"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	IpAddress  string    `json:"ipAddress"`
+	UserAgent  string    `json:"userAgent"`
+	Current    bool      `json:"current"` // true for the session that made this request
+}
+
+func CreateResponseSession(session repositories.Session, currentID uuid.UUID) Session {
+	return Session{
+		Id:         session.ID.String(),
+		CreatedAt:  session.CreatedAt,
+		LastUsedAt: session.LastUsedAt,
+		ExpiresAt:  session.ExpiresAt,
+		IpAddress:  session.IPAddress,
+		UserAgent:  session.UserAgent,
+		Current:    currentID != uuid.Nil && session.ID == currentID,
+	}
+}
@@ -10,12 +10,19 @@ type User struct {
 	FirstName string `json:"firstName" validate:"required,min=2,max=32"`
 	LastName  string `json:"lastName" validate:"required ,min=2,max=31"`
 	Email     string `json:"email" validate:"required,email"`
+	Role      string `json:"role"`
+	// Read-only: set by POST /api/verify-email, never by the client.
+	EmailVerified bool `json:"emailVerified"`
+	// Read-only: service accounts are created by admins via POST /api/service-accounts.
+	ServiceAccount bool `json:"serviceAccount"`
 }
 
 type UpdateUser struct {
 	FirstName *string `json:"firstName" validate:"omitempty,min=2,max=32"`
 	LastName  *string `json:"lastName" validate:"omitempty,min=2,max=31"`
 	Email     *string `json:"email" validate:"omitempty,email"`
+	// Only admins may change a role; UpdateUser rejects it for everyone else.
+	Role *string `json:"role" validate:"omitempty,oneof=admin customer"`
 }
 
 // CreateResponseUser is a "Mapper" function.
@@ -28,5 +35,9 @@ func CreateResponseUser(user models.User) User {
 		FirstName: user.FirstName,
 		LastName:  user.LastName,
 		Email:     user.Email,
+		Role:      string(user.Role),
+
+		EmailVerified:  user.EmailVerified,
+		ServiceAccount: user.ServiceAccount,
 	}
 }
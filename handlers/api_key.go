@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/amanguptak/fiber-api/auth"
+	"github.com/amanguptak/fiber-api/dtos"
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/amanguptak/fiber-api/repositories"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func listAPIKeys(c *fiber.Ctx, userID uuid.UUID) error {
+	keys, err := repositories.ListAPIKeys(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	responseKeys := make([]dtos.APIKey, 0, len(keys))
+	for _, key := range keys {
+		responseKeys = append(responseKeys, dtos.CreateResponseAPIKey(key))
+	}
+	return c.Status(fiber.StatusOK).JSON(responseKeys)
+}
+
+func createAPIKey(c *fiber.Ctx, owner models.User, createdByID uuid.UUID) error {
+	var data dtos.CreateAPIKey
+
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(helpers.FormatValidationErrors(err))
+	}
+
+	// A key can never do more than its owner: only admins' keys may carry admin scopes.
+	if owner.Role != models.RoleAdmin {
+		for _, scope := range data.Scopes {
+			if slices.Contains(auth.AdminScopes, scope) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "scope " + scope + " is only available to admins"})
+			}
+		}
+	}
+
+	var expiresAt *time.Time
+	if data.ExpiresInDays > 0 {
+		expires := time.Now().AddDate(0, 0, data.ExpiresInDays)
+		expiresAt = &expires
+	}
+
+	scopes := slices.Compact(slices.Sorted(slices.Values(data.Scopes)))
+	key, apiKey, err := repositories.CreateAPIKey(owner.ID, createdByID, data.Name, scopes, expiresAt)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create API key"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(dtos.CreatedAPIKey{
+		APIKey: dtos.CreateResponseAPIKey(apiKey),
+		Key:    key,
+	})
+}
+
+func revokeAPIKey(c *fiber.Ctx, userID uuid.UUID, param string) error {
+	keyID, err := uuid.Parse(c.Params(param))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": repositories.ErrAPIKeyNotFound.Error()})
+	}
+
+	err = repositories.RevokeAPIKey(userID, keyID)
+	if errors.Is(err, repositories.ErrAPIKeyNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not revoke API key"})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "API key revoked"})
+}
+
+// GetAPIKeys lists the caller's API keys.
+func GetAPIKeys(c *fiber.Ctx) error {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+	return listAPIKeys(c, principal.UserID)
+}
+
+// CreateAPIKey creates a key for the caller and returns it; it is not shown again.
+func CreateAPIKey(c *fiber.Ctx) error {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+
+	user := models.User{}
+	if err := findUser(principal.UserID.String(), &user); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	// Go by the role this request has, not the stored one: with REQUIRE_ADMIN_MFA an admin
+	// without two-factor authentication is a customer here, and must not mint admin keys.
+	user.Role = principal.Role
+	return createAPIKey(c, user, principal.UserID)
+}
+
+// RevokeAPIKey revokes one of the caller's keys.
+func RevokeAPIKey(c *fiber.Ctx) error {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+	return revokeAPIKey(c, principal.UserID, "id")
+}
+
+// GetUserAPIKeys lists the keys of the user in :id (admin).
+func GetUserAPIKeys(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user does not exist"})
+	}
+	return listAPIKeys(c, userID)
+}
+
+// CreateUserAPIKey creates a key for the user in :id (admin), e.g. for a service account.
+func CreateUserAPIKey(c *fiber.Ctx) error {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+
+	user := models.User{}
+	if err := findUser(c.Params("id"), &user); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	return createAPIKey(c, user, principal.UserID)
+}
+
+// RevokeUserAPIKey revokes one key of the user in :id (admin).
+func RevokeUserAPIKey(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user does not exist"})
+	}
+	return revokeAPIKey(c, userID, "keyId")
+}
+
+// CreateServiceAccount adds a machine user (admin). It has no password; give it a key with
+// POST /api/users/:id/api-keys.
+func CreateServiceAccount(c *fiber.Ctx) error {
+	var data dtos.CreateServiceAccount
+
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(helpers.FormatValidationErrors(err))
+	}
+
+	user, err := repositories.CreateServiceAccount(data.Name, models.Role(data.Role))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create service account"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(dtos.CreateResponseUser(user))
+}
+
+// GetServiceAccounts lists the machine users (admin).
+func GetServiceAccounts(c *fiber.Ctx) error {
+	users := []models.User{}
+	if err := helpers.DB().Where("service_account = ?", true).Find(&users).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	responseUsers := make([]dtos.User, 0, len(users))
+	for _, user := range users {
+		responseUsers = append(responseUsers, dtos.CreateResponseUser(user))
+	}
+	return c.Status(fiber.StatusOK).JSON(responseUsers)
+}
@@ -1,23 +1,72 @@
 package handlers
 
 import (
+	"log"
+	"math"
+	"strconv"
 	"time"
 
+	"github.com/amanguptak/fiber-api/config"
 	"github.com/amanguptak/fiber-api/dtos"
 	"github.com/amanguptak/fiber-api/helpers"
 	"github.com/amanguptak/fiber-api/models"
+	"github.com/amanguptak/fiber-api/password"
 	"github.com/amanguptak/fiber-api/repositories"
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// refreshCookiePath limits the refresh cookie to the routes that use it, /api/auth/refresh and
+// /api/auth/logout; no other request carries it.
+const refreshCookiePath = "/api/auth"
+
+// legacyRefreshCookieExpiry deletes the refresh cookie as it was set before refreshCookiePath,
+// at path "/". A cookie with another path is another cookie to the browser, so setting ours does
+// not replace it: it would stay next to ours, and after logout its old token, long since rotated
+// or revoked, would arrive at /api/auth/refresh alone and be taken for a stolen token.
+const legacyRefreshCookieExpiry = "refresh_token=; Path=/; Expires=Thu, 01 Jan 1970 00:00:00 GMT; Max-Age=0; HttpOnly; SameSite=Lax"
+
+// setRefreshCookie puts the refresh token in the cookie used by /api/auth/refresh and /api/auth/logout.
+func setRefreshCookie(c *fiber.Ctx, refreshToken string, expiresAt time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "refresh_token",
+		Value:    refreshToken,
+		Path:     refreshCookiePath,
+		Expires:  expiresAt,
+		HTTPOnly: true,                    // CRITICAL: JavaScript cannot read this. Prevents XSS attacks.
+		SameSite: "Lax",                   // CSRF protection
+		Secure:   config.App.CookieSecure, // HTTPS only; on by default when APP_ENV=production
+	})
+
+	// c.Cookie keeps one cookie per name, so the second refresh_token cookie goes in as a header.
+	legacy := legacyRefreshCookieExpiry
+	if config.App.CookieSecure {
+		legacy += "; Secure"
+	}
+	c.Response().Header.Add(fiber.HeaderSetCookie, legacy)
+}
+
+// clearRefreshCookie removes the refresh cookie (it needs the same path it was set with).
+func clearRefreshCookie(c *fiber.Ctx) {
+	setRefreshCookie(c, "", time.Unix(0, 0))
+}
+
+// clientInfo is what we record about the caller on each refresh token.
+func clientInfo(c *fiber.Ctx) repositories.ClientInfo {
+	return repositories.ClientInfo{IPAddress: c.IP(), UserAgent: c.Get(fiber.HeaderUserAgent)}
+}
+
+// accessTokenRef is what the session remembers about its access token, to denylist it on revoke.
+func accessTokenRef(claims *helpers.Claims) repositories.AccessTokenRef {
+	return repositories.AccessTokenRef{ID: claims.ID, ExpiresAt: claims.ExpiresAt.Time}
+}
+
 func Register(c *fiber.Ctx) error {
 	var data dtos.RegisterRequest
 
 	if err := c.BodyParser(&data); err != nil {
-		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
 	}
 
 	validate := validator.New()
@@ -26,13 +75,20 @@ func Register(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(helpers.FormatValidationErrors(err))
 	}
 
-	password, _ := bcrypt.GenerateFromPassword([]byte(data.Password), 12)
+	if err := password.Validate(data.Password, data.Email); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Password": err.Error()})
+	}
+
+	passwordHash, err := password.Hash(data.Password)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create user"})
+	}
 
 	user := models.User{
 		FirstName: data.FirstName,
 		LastName:  data.LastName,
 		Email:     data.Email,
-		Password:  password,
+		Password:  passwordHash,
 	}
 
 	if err := helpers.DB().Create(&user).Error; err != nil {
@@ -40,6 +96,8 @@ func Register(c *fiber.Ctx) error {
 			// "error":err.Error(),
 			"error": "Could not create user"})
 	}
+	startEmailVerification(user)
+
 	responseUser := dtos.CreateResponseUser(user)
 	return c.Status(fiber.StatusOK).JSON(responseUser)
 }
@@ -58,30 +116,110 @@ func Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(helpers.FormatValidationErrors(err))
 	}
 
+	// Failed logins count against the account and the client address. While either is locked,
+	// even the right password is refused, so guessing cannot continue in the background.
+	throttleKeys := []repositories.ThrottleKey{repositories.AccountThrottleKey(data.Email), repositories.IPThrottleKey(c.IP())}
+	wait, err := repositories.LoginLockedFor(throttleKeys...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not log in"})
+	}
+	if wait > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "too many failed login attempts, try again later"})
+	}
+
 	var user models.User
 
 	helpers.DB().Where("email = ?", data.Email).First(&user)
 
-	if user.ID == uuid.Nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	// Unknown email and wrong password get the same answer, and both run one hash comparison,
+	// so neither the response nor its timing tells an attacker which emails have an account.
+	// Accounts without a usable hash (created through the identity provider, which leaves the
+	// password empty) compare against the dummy as well and can never match.
+	passwordHash := user.Password
+	usable := user.ID != uuid.Nil && password.Recognized(passwordHash)
+	if !usable {
+		passwordHash = password.DummyHash()
+	}
+	matched, rehash, _ := password.Verify(data.Password, passwordHash)
+	if !matched || !usable {
+		if err := repositories.RecordLoginFailure(throttleKeys...); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not log in"})
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid email or password",
+		})
 	}
 
-	if err := bcrypt.CompareHashAndPassword(user.Password, []byte(data.Password)); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid credentials",
+	// The account's counter starts over; the IP's does not, or an attacker could reset it
+	// by logging in to an account of their own between guesses. If that fails, the login still
+	// counts; the old failures only expire on their own.
+	if err := repositories.ResetLoginFailures(repositories.AccountThrottleKey(data.Email)); err != nil {
+		log.Printf("reset login failures of user %s: %v", user.ID, err)
+	}
+
+	// The stored hash uses an older algorithm or parameters: now that we have the plain password,
+	// replace it. A failure here is not worth failing the login for; we try again next time.
+	if rehash {
+		if newHash, err := password.Hash(data.Password); err == nil {
+			if err := helpers.DB().Model(&user).Update("password", newHash).Error; err != nil {
+				log.Printf("rehash password of user %s: %v", user.ID, err)
+			}
+		}
+	}
+
+	// Checked after the password, so only the owner of the account learns that it is unverified.
+	if config.App.RequireVerifiedEmail == config.VerifyLogin && !user.EmailVerified {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "email not verified"})
+	}
+
+	return finishLogin(c, user)
+}
+
+// finishLogin runs once the user proved who they are (password, identity provider, ...).
+// With two-factor authentication on, that alone does not log in: hand out a short-lived
+// "mfa pending" token that VerifyMFA exchanges, together with a code, for the real tokens.
+func finishLogin(c *fiber.Ctx, user models.User) error {
+	hasTOTP, err := repositories.HasTOTP(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not log in"})
+	}
+	if hasTOTP {
+		mfaToken, err := helpers.GenerateToken(helpers.MFAPendingToken, user.ID.String(), "", time.Now().Add(config.App.MFAPendingTTL))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create token"})
+		}
+		return c.JSON(fiber.Map{
+			"message":     "Two-factor authentication required",
+			"mfaRequired": true,
+			"mfaToken":    mfaToken,
 		})
 	}
+
+	return startSession(c, user)
+}
+
+// startSession finishes a successful login: it issues the access token, starts a new refresh
+// token family (session) and sets the refresh cookie.
+func startSession(c *fiber.Ctx, user models.User) error {
 	// USE HELPER: Generate Access Token (15 mins)
 	// We use our helper to create a short-lived token for API access.
 
-	token, _ := helpers.GenerateToken(user.ID.String(), time.Now().Add(time.Minute*15))
+	token, accessClaims, err := helpers.IssueToken(helpers.AccessToken, user.ID.String(), string(user.Role), time.Now().Add(config.App.AccessTokenTTL))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create token"})
+	}
 
 	// USE HELPER: Generate Refresh Token (7 days)
 	// We create a long-lived token so the user doesn't have to login every 15 mins.
 
-	refreshToken, _ := helpers.GenerateToken(user.ID.String(), time.Now().Add(time.Hour*24*7))
+	refreshExpiresAt := time.Now().Add(config.App.RefreshTokenTTL)
+	refreshToken, err := helpers.GenerateToken(helpers.RefreshToken, user.ID.String(), string(user.Role), refreshExpiresAt)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create token"})
+	}
 
-	if err := repositories.StoreRefreshToken(user.ID, refreshToken, time.Now().Add(7*24*time.Hour)); err != nil {
+	if err := repositories.StoreRefreshToken(user.ID, refreshToken, refreshExpiresAt, accessTokenRef(accessClaims), clientInfo(c)); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
@@ -89,15 +227,7 @@ func Login(c *fiber.Ctx) error {
 
 	// Set Cookie
 	// We put the Refresh Token in an HttpOnly cookie
-	cookie := fiber.Cookie{
-		Name:     "refresh_token",
-		Value:    refreshToken,
-		Expires:  time.Now().Add(time.Hour * 24 * 7),
-		HTTPOnly: true,  // CRITICAL: JavaScript cannot read this. Prevents XSS attacks.
-		SameSite: "Lax", // CSRF protection
-		Secure:   false, // Set to true in production (HTTPS only)
-	}
-	c.Cookie(&cookie)
+	setRefreshCookie(c, refreshToken, refreshExpiresAt)
 	return c.JSON(fiber.Map{
 		"message": "Login successfully",
 		"token":   token,
@@ -107,21 +237,29 @@ func Login(c *fiber.Ctx) error {
 func Logout(c *fiber.Ctx) error {
 	cookie := c.Cookies("refresh_token")
 
-	// Mark token as revoked in DB (best practice)
-	hash := repositories.HashToken(cookie)
-	helpers.DB().Model(&models.RefreshToken{}).
-		Where("token_hash = ?", hash).
-		Update("is_revoked", true)
+	// Revoke the whole session (every token of this family), not only the current token,
+	// so a rotated-but-still-in-grace sibling cannot keep the session alive.
+	var dbToken models.RefreshToken
+	if err := helpers.DB().Where("token_hash = ?", repositories.HashToken(cookie)).First(&dbToken).Error; err == nil {
+		repositories.RevokeSession(dbToken.UserID, dbToken.FamilyID)
+	}
+
+	// The access token sent along is denylisted too, even if it came from another session of ours.
+	if claims, err := helpers.ClaimsFromHeader(c.Get("Authorization")); err == nil {
+		if userID, err := uuid.Parse(claims.Subject); err == nil {
+			repositories.RevokeAccessToken(userID, claims.ID, claims.ExpiresAt.Time)
+		}
+	}
 
 	// Clear cookie
-	c.ClearCookie("refresh_token")
+	clearRefreshCookie(c)
 	return c.JSON(fiber.Map{"message": "Logged out successfully"})
 }
 
 func Refresh(c *fiber.Ctx) error {
 	cookie := c.Cookies("refresh_token")
-	token, err := helpers.ParseToken(cookie)
-	if err != nil || !token.Valid {
+	// Only a refresh token (typ "refresh") may be exchanged here, never an access token.
+	if _, err := helpers.ParseToken(cookie, helpers.RefreshToken); err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "unauthenticated",
 		})
@@ -134,20 +272,13 @@ func Refresh(c *fiber.Ctx) error {
 	// But now with Rotation: The database IS the source of truth. We don't trust the JWT claims alone anymore.
 
 	// ✅ Get BOTH tokens
-	newAccessToken, newRefreshToken, err := repositories.RotateRefreshToken(cookie)
+	newAccessToken, newRefreshToken, err := repositories.RotateRefreshToken(cookie, clientInfo(c))
 	if err != nil {
-		c.ClearCookie("refresh_token")
+		clearRefreshCookie(c)
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Invalid token"})
 	}
 	// ✅ Send NEW Refresh Token as HttpOnly cookie
-	c.Cookie(&fiber.Cookie{
-		Name:     "refresh_token",
-		Value:    newRefreshToken,
-		Expires:  time.Now().Add(7 * 24 * time.Hour),
-		HTTPOnly: true,
-		SameSite: "Lax", // CSRF protection
-		Secure:   false, // Set to true in production (HTTPS only)
-	})
+	setRefreshCookie(c, newRefreshToken, time.Now().Add(config.App.RefreshTokenTTL))
 
 	// ✅ Return NEW Access Token in JSON
 	return c.JSON(fiber.Map{
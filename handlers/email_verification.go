@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+
+	"github.com/amanguptak/fiber-api/config"
+	"github.com/amanguptak/fiber-api/dtos"
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/mailer"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/amanguptak/fiber-api/repositories"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// startEmailVerification issues a verification token and emails it in the background.
+// Errors are only logged: the caller's request (e.g. Register) succeeded either way,
+// and the user can ask for another email with ResendVerification.
+func startEmailVerification(user models.User) {
+	token, err := repositories.CreateEmailVerificationToken(user.ID)
+	if errors.Is(err, repositories.ErrVerificationCooldown) {
+		return
+	}
+	if err != nil {
+		log.Printf("verification token for user %s: %v", user.ID, err)
+		return
+	}
+
+	go func() {
+		link := config.App.BaseURL + "/verify-email?token=" + url.QueryEscape(token)
+		message := mailer.Message{
+			To:      user.Email,
+			Subject: "Confirm your email address",
+			Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening this link within %s:\n\n%s\n\nIf you did not create an account, ignore this email.\n",
+				user.FirstName, config.App.EmailVerificationTTL, link),
+		}
+		if err := mailer.Default.Send(message); err != nil {
+			log.Printf("verification email to user %s failed: %v", user.ID, err)
+		}
+	}()
+}
+
+// VerifyEmail confirms the email address with the token from the verification email.
+func VerifyEmail(c *fiber.Ctx) error {
+	var data dtos.VerifyEmailRequest
+
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(helpers.FormatValidationErrors(err))
+	}
+
+	user, err := repositories.VerifyEmail(data.Token)
+	if errors.Is(err, repositories.ErrVerificationTokenInvalid) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not verify email"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(dtos.CreateResponseUser(user))
+}
+
+// ResendVerification sends a new verification email. It is public, because with
+// REQUIRE_VERIFIED_EMAIL=login an unverified user cannot log in to ask for one. Like
+// ForgotPassword it answers the same for every email; the per-account cooldown is applied
+// silently so the answer does not reveal whether an account exists.
+func ResendVerification(c *fiber.Ctx) error {
+	var data dtos.ResendVerificationRequest
+
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(helpers.FormatValidationErrors(err))
+	}
+
+	var user models.User
+	if err := helpers.DB().Where("email = ?", data.Email).First(&user).Error; err == nil && !user.EmailVerified {
+		startEmailVerification(user)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "If this email belongs to an unverified account, a verification link has been sent",
+	})
+}
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"github.com/amanguptak/fiber-api/dtos"
+	"github.com/amanguptak/fiber-api/jobs"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetJobs shows the last-run status of every background job (admin).
+func GetJobs(c *fiber.Ctx) error {
+	statuses := jobs.Default.Statuses()
+
+	responseJobs := make([]dtos.JobStatus, 0, len(statuses))
+	for _, status := range statuses {
+		responseJobs = append(responseJobs, dtos.CreateResponseJobStatus(status))
+	}
+	return c.Status(fiber.StatusOK).JSON(responseJobs)
+}
@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/gofiber/fiber/v2"
+)
+
+// JWKS publishes our public signing keys so other services can verify access tokens
+// without ever holding the private key. Keys are matched to tokens by the "kid" header.
+func JWKS(c *fiber.Ctx) error {
+	// Verifiers cache this; a short max-age keeps rotations visible quickly.
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.Status(fiber.StatusOK).JSON(helpers.PublicJWKS())
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/amanguptak/fiber-api/config"
+	"github.com/amanguptak/fiber-api/dtos"
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/mailer"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/amanguptak/fiber-api/repositories"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// magicLinkCookie binds a login link to the browser that asked for it, so a link forwarded,
+// leaked from a mailbox or planted by an attacker (login CSRF) does not log in anyone else.
+const magicLinkCookie = "magic_link_nonce"
+
+func setMagicLinkCookie(c *fiber.Ctx, nonce string, expiresAt time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     magicLinkCookie,
+		Value:    nonce,
+		Path:     "/api/magic-link",
+		Expires:  expiresAt,
+		HTTPOnly: true,
+		SameSite: "Lax",
+		Secure:   config.App.CookieSecure,
+	})
+}
+
+// SendMagicLink emails a one-time login link. Like ForgotPassword it answers the same whether
+// or not the email belongs to an account, and the per-account hourly limit is applied silently;
+// the browser always gets a fresh nonce cookie, so that does not tell accounts apart either.
+func SendMagicLink(c *fiber.Ctx) error {
+	var data dtos.MagicLinkRequest
+
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(helpers.FormatValidationErrors(err))
+	}
+
+	nonce, err := repositories.NewMagicLinkNonce()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create login link"})
+	}
+
+	var user models.User
+	// Service accounts cannot log in interactively at all.
+	if err := helpers.DB().Where("email = ? AND service_account = ?", data.Email, false).First(&user).Error; err == nil {
+		token, err := repositories.CreateMagicLink(user.ID, nonce)
+		if err != nil && !errors.Is(err, repositories.ErrMagicLinkRateLimited) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create login link"})
+		}
+		if err == nil {
+			go sendMagicLinkEmail(user, token)
+		}
+	}
+
+	setMagicLinkCookie(c, nonce, time.Now().Add(config.App.MagicLinkTTL))
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "If an account exists for this email, a login link has been sent",
+	})
+}
+
+func sendMagicLinkEmail(user models.User, token string) {
+	link := config.App.BaseURL + "/magic-link?token=" + url.QueryEscape(token)
+	message := mailer.Message{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen this link within %s to log in. It works once, and only in the browser where you asked for it:\n\n%s\n\nIf you did not ask to log in, ignore this email.\n",
+			user.FirstName, config.App.MagicLinkTTL, link),
+	}
+	if err := mailer.Default.Send(message); err != nil {
+		log.Printf("login link email to user %s failed: %v", user.ID, err)
+	}
+}
+
+// ConsumeMagicLink logs in with a token from a login link, in the browser that asked for it.
+// It ends like Login: the access token, the refresh cookie, or the two-factor step.
+func ConsumeMagicLink(c *fiber.Ctx) error {
+	var data dtos.ConsumeMagicLinkRequest
+
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(helpers.FormatValidationErrors(err))
+	}
+
+	claims, err := helpers.ParseToken(data.Token, helpers.MagicLinkToken)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": repositories.ErrMagicLinkInvalid.Error()})
+	}
+
+	nonce := c.Cookies(magicLinkCookie)
+	if nonce == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": repositories.ErrMagicLinkOtherBrowser.Error()})
+	}
+
+	user, err := repositories.ConsumeMagicLink(claims, nonce)
+	if errors.Is(err, repositories.ErrMagicLinkInvalid) || errors.Is(err, repositories.ErrMagicLinkOtherBrowser) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, repositories.ErrMagicLinkUnverified) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not log in"})
+	}
+
+	// The link is used up; the nonce has no further purpose.
+	setMagicLinkCookie(c, "", time.Unix(0, 0))
+	return finishLogin(c, user)
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/amanguptak/fiber-api/auth"
+	"github.com/amanguptak/fiber-api/config"
+	"github.com/amanguptak/fiber-api/dtos"
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/amanguptak/fiber-api/repositories"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxMFAAttempts wrong codes kill an "mfa pending" token; the user has to enter the password again.
+	maxMFAAttempts = 5
+	// maxMFAUserAttempts wrong codes per user within mfaUserWindow, over all pending tokens,
+	// so logging in again and again does not buy unlimited guesses.
+	maxMFAUserAttempts = 10
+	mfaUserWindow      = 15 * time.Minute
+)
+
+// mfaUserKey is the key the wrong codes of a user are counted under, over all pending tokens.
+func mfaUserKey(userID uuid.UUID) string {
+	return "user:" + userID.String()
+}
+
+// VerifyMFA is the second step of Login for users with two-factor authentication: it exchanges
+// the "mfa pending" token and a TOTP (or recovery) code for the usual access and refresh tokens.
+func VerifyMFA(c *fiber.Ctx) error {
+	var data dtos.VerifyMFARequest
+
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(helpers.FormatValidationErrors(err))
+	}
+
+	claims, err := helpers.ParseToken(data.MfaToken, helpers.MFAPendingToken)
+	if err != nil || repositories.IsAccessTokenRevoked(claims.ID) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+
+	// The user's limit is checked before the code is: otherwise every new pending token (and a
+	// successful password login resets the login throttle) would still buy one more guess.
+	if repositories.MFAFailureCount(mfaUserKey(userID)) >= maxMFAUserAttempts {
+		repositories.RevokeAccessToken(userID, claims.ID, claims.ExpiresAt.Time)
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "too many invalid codes, try again later"})
+	}
+
+	if err := repositories.VerifyMFACode(userID, data.Code); err != nil {
+		tokenFailures := repositories.RecordMFAFailure(claims.ID, claims.ExpiresAt.Time)
+		userFailures := repositories.RecordMFAFailure(mfaUserKey(userID), time.Now().Add(mfaUserWindow))
+		if tokenFailures >= maxMFAAttempts || userFailures >= maxMFAUserAttempts {
+			repositories.RevokeAccessToken(userID, claims.ID, claims.ExpiresAt.Time)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "too many invalid codes, log in again"})
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": repositories.ErrInvalidMFACode.Error()})
+	}
+
+	// The pending token is single-use: denylist it before handing out the real tokens.
+	if err := repositories.RevokeAccessToken(userID, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not log in"})
+	}
+
+	var user models.User
+	if err := findUser(userID.String(), &user); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+	return startSession(c, user)
+}
+
+// EnrollTOTP creates a new authenticator secret for the caller. The app is scanned from the
+// otpauth:// URI (as a QR code); two-factor authentication is on only after ConfirmTOTP.
+func EnrollTOTP(c *fiber.Ctx) error {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+
+	var user models.User
+	if err := findUser(principal.UserID.String(), &user); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	secret, err := repositories.EnrollTOTP(user.ID)
+	if errors.Is(err, repositories.ErrMFAAlreadyEnabled) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not start enrollment"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"secret":     secret,
+		"otpauthUri": helpers.TOTPProvisioningURI(config.App.TOTPIssuer, user.Email, secret),
+	})
+}
+
+// ConfirmTOTP turns two-factor authentication on with a first code from the app,
+// and returns the recovery codes. They are never shown again.
+// Every other session of the user is revoked, since those logged in without a second factor.
+func ConfirmTOTP(c *fiber.Ctx) error {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+
+	var data dtos.MFACodeRequest
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(helpers.FormatValidationErrors(err))
+	}
+
+	codes, err := repositories.ConfirmTOTP(principal.UserID, data.Code)
+	if errors.Is(err, repositories.ErrMFANotEnabled) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "start with POST /api/mfa/totp/enroll"})
+	}
+	if errors.Is(err, repositories.ErrMFAAlreadyEnabled) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, repositories.ErrInvalidMFACode) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not enable two-factor authentication"})
+	}
+
+	// Sessions logged in with the password alone end here; only this one stays.
+	if _, err := repositories.RevokeOtherSessions(principal.UserID, currentSessionID(c, principal.UserID)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not revoke other sessions"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":       "Two-factor authentication enabled. Store these recovery codes somewhere safe, they are shown only once",
+		"recoveryCodes": codes,
+	})
+}
+
+// DisableTOTP turns two-factor authentication off. It needs a current code (or a recovery code).
+// Wrong codes count against the same per-user limit as VerifyMFA, so a stolen access token cannot
+// be used to guess codes until two-factor authentication is off.
+func DisableTOTP(c *fiber.Ctx) error {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+
+	var data dtos.MFACodeRequest
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(helpers.FormatValidationErrors(err))
+	}
+
+	userKey := mfaUserKey(principal.UserID)
+	if repositories.MFAFailureCount(userKey) >= maxMFAUserAttempts {
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "too many invalid codes, try again later"})
+	}
+
+	err := repositories.DisableTOTP(principal.UserID, data.Code)
+	if errors.Is(err, repositories.ErrMFANotEnabled) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, repositories.ErrInvalidMFACode) {
+		if repositories.RecordMFAFailure(userKey, time.Now().Add(mfaUserWindow)) >= maxMFAUserAttempts {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "too many invalid codes, try again later"})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not disable two-factor authentication"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Two-factor authentication disabled"})
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amanguptak/fiber-api/config"
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/middleware"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/amanguptak/fiber-api/password"
+	"github.com/gofiber/fiber/v2"
+)
+
+func newMFATestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	openTestDB(t)
+	if err := helpers.LoadSigningKeys(config.App); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Post("/api/login", Login)
+	api := app.Group("/api", middleware.IsAuthenticated)
+	api.Post("/mfa/totp/enroll", middleware.RequireLogin, EnrollTOTP)
+	api.Post("/mfa/totp/confirm", middleware.RequireLogin, ConfirmTOTP)
+	api.Get("/sessions", middleware.RequireLogin, GetSessions)
+	return app
+}
+
+// send makes a JSON request with an optional bearer token and decodes a successful answer into out.
+func send(t *testing.T, app *fiber.App, method string, path string, token string, body string, out any) int {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < fiber.StatusBadRequest {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestConfirmTOTPKeepsTheCallersSession(t *testing.T) {
+	app := newMFATestApp(t)
+
+	hash, err := password.Hash("Corr3ct-horse-42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{FirstName: "Al", LastName: "Bo", Email: "al@example.com", Password: hash, EmailVerified: true}
+	if err := helpers.DB().Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	login := func() string {
+		var body struct{ Token string }
+		status := send(t, app, fiber.MethodPost, "/api/login", "", `{"email":"al@example.com","password":"Corr3ct-horse-42"}`, &body)
+		if status != fiber.StatusOK || body.Token == "" {
+			t.Fatalf("login: status %d, token %q", status, body.Token)
+		}
+		return body.Token
+	}
+	here, elsewhere := login(), login()
+
+	var enrolled struct{ Secret string }
+	if status := send(t, app, fiber.MethodPost, "/api/mfa/totp/enroll", here, "", &enrolled); status != fiber.StatusOK {
+		t.Fatalf("enroll: status %d", status)
+	}
+	code, err := helpers.TOTPCode(enrolled.Secret, helpers.TOTPStep(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := send(t, app, fiber.MethodPost, "/api/mfa/totp/confirm", here, `{"code":"`+code+`"}`, nil); status != fiber.StatusOK {
+		t.Fatalf("confirm: status %d", status)
+	}
+
+	// The session that turned two-factor authentication on goes on, and knows it is the current one.
+	var sessions []struct{ Current bool }
+	if status := send(t, app, fiber.MethodGet, "/api/sessions", here, "", &sessions); status != fiber.StatusOK {
+		t.Fatalf("caller's session after confirm: status %d, want %d", status, fiber.StatusOK)
+	}
+	if len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("sessions = %+v, want only the current one", sessions)
+	}
+
+	// The other one logged in with the password alone and is over.
+	if status := send(t, app, fiber.MethodGet, "/api/sessions", elsewhere, "", nil); status != fiber.StatusUnauthorized {
+		t.Errorf("other session after confirm: status %d, want %d", status, fiber.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/amanguptak/fiber-api/auth"
+	"github.com/amanguptak/fiber-api/config"
+	"github.com/amanguptak/fiber-api/dtos"
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/amanguptak/fiber-api/repositories"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// oauthError answers in the OAuth 2.0 error format (RFC 6749 section 5.2), which clients parse
+// by its "error" code.
+func oauthError(c *fiber.Ctx, status int, code string, description string) error {
+	if status == fiber.StatusUnauthorized {
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="oauth"`)
+	}
+	return c.Status(status).JSON(fiber.Map{"error": code, "error_description": description})
+}
+
+// oauthClient authenticates the calling client, with HTTP Basic (client_secret_basic) or
+// client_id and client_secret in the form (client_secret_post).
+func oauthClient(c *fiber.Ctx) (models.OAuthClient, error) {
+	clientID, secret := c.FormValue("client_id"), c.FormValue("client_secret")
+
+	if header := c.Get(fiber.HeaderAuthorization); header != "" {
+		encoded, found := strings.CutPrefix(header, "Basic ")
+		if !found {
+			return models.OAuthClient{}, repositories.ErrInvalidClient
+		}
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return models.OAuthClient{}, repositories.ErrInvalidClient
+		}
+		id, password, _ := strings.Cut(string(raw), ":")
+		// Both halves are form-urlencoded before going into the header (RFC 6749 section 2.3.1).
+		if clientID, err = url.QueryUnescape(id); err != nil {
+			return models.OAuthClient{}, repositories.ErrInvalidClient
+		}
+		if secret, err = url.QueryUnescape(password); err != nil {
+			return models.OAuthClient{}, repositories.ErrInvalidClient
+		}
+	}
+
+	if clientID == "" || secret == "" {
+		return models.OAuthClient{}, repositories.ErrInvalidClient
+	}
+	return repositories.AuthenticateOAuthClient(clientID, secret)
+}
+
+// requestedScopes reads the space-separated "scope" parameter; nil when it is missing.
+func requestedScopes(c *fiber.Ctx) []string {
+	scope := strings.Fields(c.FormValue("scope"))
+	if len(scope) == 0 {
+		return nil
+	}
+	return slices.Compact(slices.Sorted(slices.Values(scope)))
+}
+
+// OAuthToken is the token endpoint for registered clients. It supports the client_credentials
+// grant, which mints tokens for the client's own service account, and the refresh_token grant.
+// client_credentials also returns a refresh token (RFC 6749 says it should not need one):
+// rotating it keeps reuse detection, and revoking it ends the access tokens issued with it.
+func OAuthToken(c *fiber.Ctx) error {
+	// Responses with tokens must not be cached (RFC 6749 section 5.1).
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderPragma, "no-cache")
+
+	client, err := oauthClient(c)
+	if err != nil {
+		return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "client authentication failed")
+	}
+
+	requested := requestedScopes(c)
+	var grant repositories.TokenGrant
+
+	switch c.FormValue("grant_type") {
+	case "client_credentials":
+		allowed := client.ScopeList()
+		if requested == nil {
+			requested = allowed
+		}
+		for _, scope := range requested {
+			if !slices.Contains(allowed, scope) {
+				return oauthError(c, fiber.StatusBadRequest, "invalid_scope", "scope "+scope+" is not allowed for this client")
+			}
+		}
+		grant, err = repositories.IssueClientTokens(client, requested, clientInfo(c))
+		if err != nil {
+			return oauthError(c, fiber.StatusInternalServerError, "server_error", "could not issue tokens")
+		}
+
+	case "refresh_token":
+		refreshToken := c.FormValue("refresh_token")
+		if _, err := helpers.ParseToken(refreshToken, helpers.RefreshToken); err != nil {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "refresh token is invalid")
+		}
+		grant, err = repositories.RotateClientRefreshToken(refreshToken, client.ClientID, requested, clientInfo(c))
+		if errors.Is(err, repositories.ErrInvalidScope) {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_scope", err.Error())
+		}
+		if err != nil {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "refresh token is invalid, expired or revoked")
+		}
+
+	case "":
+		return oauthError(c, fiber.StatusBadRequest, "invalid_request", "grant_type is required")
+	default:
+		return oauthError(c, fiber.StatusBadRequest, "unsupported_grant_type", "supported: client_credentials, refresh_token")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(dtos.TokenResponse{
+		AccessToken:  grant.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(config.App.AccessTokenTTL.Seconds()),
+		RefreshToken: grant.RefreshToken,
+		Scope:        strings.Join(grant.Scopes, " "),
+	})
+}
+
+// OAuthIntrospect tells a registered client whether a token is active and what it carries
+// (RFC 7662). Access tokens of anyone can be introspected, so services can check the tokens
+// sent to them; refresh tokens only by the client they were issued to.
+func OAuthIntrospect(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	client, err := oauthClient(c)
+	if err != nil {
+		return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "client authentication failed")
+	}
+
+	token := c.FormValue("token")
+	if token == "" {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_request", "token is required")
+	}
+
+	// token_type_hint only says where to look first, and a JWT tells us its type anyway.
+	if claims, err := helpers.ParseToken(token, helpers.AccessToken); err == nil {
+		if repositories.IsAccessTokenRevoked(claims.ID) {
+			return c.JSON(dtos.Introspection{Active: false})
+		}
+		return c.JSON(dtos.Introspection{
+			Active:    true,
+			Scope:     claims.Scope,
+			ClientId:  claims.ClientID,
+			TokenType: "access_token",
+			Exp:       claims.ExpiresAt.Unix(),
+			Iat:       claims.IssuedAt.Unix(),
+			Sub:       claims.Subject,
+			Aud:       claims.Audience,
+			Iss:       claims.Issuer,
+			Jti:       claims.ID,
+		})
+	}
+
+	if claims, err := helpers.ParseToken(token, helpers.RefreshToken); err == nil {
+		dbToken, err := repositories.ClientRefreshToken(token, client.ClientID)
+		if err != nil {
+			return c.JSON(dtos.Introspection{Active: false})
+		}
+		return c.JSON(dtos.Introspection{
+			Active:    true,
+			Scope:     dbToken.Scope,
+			ClientId:  dbToken.ClientID,
+			TokenType: "refresh_token",
+			Exp:       dbToken.ExpiresAt.Unix(),
+			Iat:       claims.IssuedAt.Unix(),
+			Sub:       claims.Subject,
+			Aud:       claims.Audience,
+			Iss:       claims.Issuer,
+			Jti:       claims.ID,
+		})
+	}
+
+	return c.JSON(dtos.Introspection{Active: false})
+}
+
+// OAuthRevoke lets a client revoke one of its own tokens (RFC 7009). A refresh token takes its
+// whole family with it. The answer is 200 whether or not the token was valid or the client's,
+// so it cannot be used to probe tokens.
+func OAuthRevoke(c *fiber.Ctx) error {
+	client, err := oauthClient(c)
+	if err != nil {
+		return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "client authentication failed")
+	}
+
+	token := c.FormValue("token")
+	if token == "" {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_request", "token is required")
+	}
+
+	if claims, err := helpers.ParseToken(token, helpers.AccessToken); err == nil {
+		if claims.ClientID == client.ClientID {
+			userID, _ := uuid.Parse(claims.Subject)
+			if err := repositories.RevokeAccessToken(userID, claims.ID, claims.ExpiresAt.Time); err != nil {
+				return oauthError(c, fiber.StatusServiceUnavailable, "server_error", "could not revoke token")
+			}
+		}
+	} else if _, err := helpers.ParseToken(token, helpers.RefreshToken); err == nil {
+		err := repositories.RevokeClientRefreshToken(token, client.ClientID)
+		if err != nil && !errors.Is(err, repositories.ErrTokenNotFound) {
+			return oauthError(c, fiber.StatusServiceUnavailable, "server_error", "could not revoke token")
+		}
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// CreateOAuthClient registers a client (admin) and returns its secret; it is not shown again.
+func CreateOAuthClient(c *fiber.Ctx) error {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+
+	var data dtos.CreateOAuthClient
+
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(helpers.FormatValidationErrors(err))
+	}
+
+	// Same rule as for API keys: admin scopes only make sense for a client acting as an admin.
+	if models.Role(data.Role) != models.RoleAdmin {
+		for _, scope := range data.Scopes {
+			if slices.Contains(auth.AdminScopes, scope) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "scope " + scope + " needs role admin"})
+			}
+		}
+	}
+
+	scopes := slices.Compact(slices.Sorted(slices.Values(data.Scopes)))
+	secret, client, err := repositories.CreateOAuthClient(data.Name, models.Role(data.Role), scopes, principal.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create OAuth client"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(dtos.CreatedOAuthClient{
+		OAuthClient:  dtos.CreateResponseOAuthClient(client),
+		ClientSecret: secret,
+	})
+}
+
+// GetOAuthClients lists the registered clients (admin).
+func GetOAuthClients(c *fiber.Ctx) error {
+	clients, err := repositories.ListOAuthClients()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	responseClients := make([]dtos.OAuthClient, 0, len(clients))
+	for _, client := range clients {
+		responseClients = append(responseClients, dtos.CreateResponseOAuthClient(client))
+	}
+	return c.Status(fiber.StatusOK).JSON(responseClients)
+}
+
+// RevokeOAuthClient disables a client and revokes its tokens (admin).
+func RevokeOAuthClient(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": repositories.ErrOAuthClientNotFound.Error()})
+	}
+
+	err = repositories.RevokeOAuthClient(id)
+	if errors.Is(err, repositories.ErrOAuthClientNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not revoke OAuth client"})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "OAuth client revoked"})
+}
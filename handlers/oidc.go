@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/amanguptak/fiber-api/config"
+	"github.com/amanguptak/fiber-api/oidc"
+	"github.com/amanguptak/fiber-api/repositories"
+	"github.com/gofiber/fiber/v2"
+)
+
+// oidcStateCookie binds a sign-in attempt to the browser that started it. Without it, an attacker
+// could start a sign-in with their own provider account and get a victim to open the callback,
+// logging the victim into the attacker's account (login CSRF).
+const oidcStateCookie = "oidc_state"
+
+func setOIDCStateCookie(c *fiber.Ctx, state string, expiresAt time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/oidc",
+		Expires:  expiresAt,
+		HTTPOnly: true,
+		SameSite: "Lax", // the callback is a top-level navigation from the provider, which Lax allows
+		Secure:   config.App.CookieSecure,
+	})
+}
+
+// OIDCLogin starts "sign in with the identity provider": it remembers a fresh state, nonce and
+// PKCE verifier and redirects the browser to the provider.
+func OIDCLogin(c *fiber.Ctx) error {
+	provider := oidc.Default
+	if provider == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "single sign-on is not configured"})
+	}
+
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not start sign-in"})
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not start sign-in"})
+	}
+
+	state, err := repositories.CreateOIDCLoginState(nonce, verifier)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not start sign-in"})
+	}
+
+	authURL, err := provider.AuthCodeURL(c.UserContext(), state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		log.Printf("oidc login: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "identity provider is unavailable"})
+	}
+
+	setOIDCStateCookie(c, state, time.Now().Add(repositories.OIDCLoginTTL))
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// OIDCCallback is where the provider sends the browser back. It checks the state, exchanges the
+// code, verifies the ID token, finds or creates the user, and then logs in like Login does.
+func OIDCCallback(c *fiber.Ctx) error {
+	provider := oidc.Default
+	if provider == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "single sign-on is not configured"})
+	}
+
+	// The attempt is over whatever happens next.
+	cookieState := c.Cookies(oidcStateCookie)
+	setOIDCStateCookie(c, "", time.Unix(0, 0))
+
+	if reason := c.Query("error"); reason != "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "sign-in was not completed at the identity provider: " + reason})
+	}
+
+	state := c.Query("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": repositories.ErrOIDCStateInvalid.Error()})
+	}
+	loginState, err := repositories.ConsumeOIDCLoginState(state)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": repositories.ErrOIDCStateInvalid.Error()})
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "code is required"})
+	}
+
+	rawIDToken, err := provider.Exchange(c.UserContext(), code, loginState.CodeVerifier)
+	if err != nil {
+		log.Printf("oidc callback: %v", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "sign-in with the identity provider failed"})
+	}
+	claims, err := provider.VerifyIDToken(c.UserContext(), rawIDToken, loginState.Nonce)
+	if err != nil {
+		log.Printf("oidc callback: %v", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "sign-in with the identity provider failed"})
+	}
+
+	user, err := repositories.UserForExternalIdentity(externalProfile(provider.Issuer, claims))
+	if errors.Is(err, repositories.ErrOIDCEmailUnverified) || errors.Is(err, repositories.ErrOIDCLinkRefused) ||
+		errors.Is(err, repositories.ErrOIDCLinkUnverified) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not log in"})
+	}
+
+	return finishLogin(c, user)
+}
+
+// externalProfile takes the user's details from the ID token. Providers differ in which name
+// claims they send, so fall back from given/family name to name to the email's local part.
+func externalProfile(issuer string, claims *oidc.IDTokenClaims) repositories.ExternalProfile {
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" {
+		first, rest, _ := strings.Cut(strings.TrimSpace(claims.Name), " ")
+		firstName = first
+		if lastName == "" {
+			lastName = strings.TrimSpace(rest)
+		}
+	}
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	return repositories.ExternalProfile{
+		Issuer:        issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		FirstName:     firstName,
+		LastName:      lastName,
+	}
+}
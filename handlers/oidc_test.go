@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/amanguptak/fiber-api/config"
+	"github.com/amanguptak/fiber-api/database"
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/amanguptak/fiber-api/oidc"
+	"github.com/amanguptak/fiber-api/oidc/oidctest"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB migrates a fresh SQLite file, opened by database.ConnectDb like the server does.
+func openTestDB(t *testing.T) {
+	t.Helper()
+
+	previous := config.App
+	config.App.DBPath = filepath.Join(t.TempDir(), "test.db")
+	database.ConnectDb()
+	database.Database.Db.Logger = logger.Default.LogMode(logger.Silent)
+
+	t.Cleanup(func() {
+		if sqlDB, err := database.Database.Db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		config.App = previous
+	})
+}
+
+// oidcTest is the app's sign-in routes, pointed at a fake identity provider.
+type oidcTest struct {
+	app  *fiber.App
+	fake *oidctest.Server
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+	openTestDB(t)
+	if err := helpers.LoadSigningKeys(config.App); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := oidctest.NewServer("client-id", "client-secret")
+	t.Cleanup(fake.Close)
+
+	previous := oidc.Default
+	oidc.Default = oidc.NewProvider(fake.URL, "client-id", "client-secret", "http://localhost:8000/api/oidc/callback", []string{"openid", "email", "profile"})
+	t.Cleanup(func() { oidc.Default = previous })
+
+	app := fiber.New()
+	app.Get("/api/oidc/login", OIDCLogin)
+	app.Get("/api/oidc/callback", OIDCCallback)
+	return &oidcTest{app: app, fake: fake}
+}
+
+// login starts a sign-in and lets the fake provider answer it. It returns the query the provider
+// sends the browser back with (code and state) and the state cookie the browser got.
+func (o *oidcTest) login(t *testing.T) (url.Values, *http.Cookie) {
+	t.Helper()
+
+	resp, err := o.app.Test(httptest.NewRequest(fiber.MethodGet, "/api/oidc/login", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("login: status %d, want %d", resp.StatusCode, fiber.StatusFound)
+	}
+	var stateCookie *http.Cookie
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == oidcStateCookie {
+			stateCookie = cookie
+		}
+	}
+	if stateCookie == nil {
+		t.Fatal("login: no state cookie")
+	}
+
+	// The fake provider signs the user in at once and redirects back to the callback.
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	authorize, err := client.Get(resp.Header.Get(fiber.HeaderLocation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorize.Body.Close()
+	callback, err := url.Parse(authorize.Header.Get(fiber.HeaderLocation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return callback.Query(), stateCookie
+}
+
+// callback finishes a sign-in like the browser coming back from the provider.
+func (o *oidcTest) callback(t *testing.T, query url.Values, stateCookie *http.Cookie) (int, map[string]any) {
+	t.Helper()
+
+	req := httptest.NewRequest(fiber.MethodGet, "/api/oidc/callback?"+query.Encode(), nil)
+	if stateCookie != nil {
+		req.AddCookie(stateCookie)
+	}
+	resp, err := o.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+func countUsers(t *testing.T) int64 {
+	t.Helper()
+	var count int64
+	if err := helpers.DB().Model(&models.User{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestOIDCCallbackCreatesAndLinksUser(t *testing.T) {
+	o := newOIDCTest(t)
+	o.fake.SetUser(oidctest.User{Subject: "42", Email: "jane@example.com", EmailVerified: true, GivenName: "Jane", FamilyName: "Doe"})
+
+	query, cookie := o.login(t)
+	status, body := o.callback(t, query, cookie)
+	if status != fiber.StatusOK {
+		t.Fatalf("status %d, want %d: %v", status, fiber.StatusOK, body)
+	}
+	if token, _ := body["token"].(string); token == "" {
+		t.Fatalf("no access token in %v", body)
+	}
+
+	var user models.User
+	if err := helpers.DB().Where("email = ?", "jane@example.com").First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !user.EmailVerified || user.FirstName != "Jane" || user.LastName != "Doe" || len(user.Password) != 0 {
+		t.Errorf("user = %+v, want verified Jane Doe without a password", user)
+	}
+	var identity models.ExternalIdentity
+	if err := helpers.DB().Where("issuer = ? AND subject = ?", o.fake.URL, "42").First(&identity).Error; err != nil {
+		t.Fatalf("identity not linked: %v", err)
+	}
+	if identity.UserID != user.ID {
+		t.Errorf("identity linked to %s, want %s", identity.UserID, user.ID)
+	}
+
+	// Signing in again finds the same user through the identity.
+	query, cookie = o.login(t)
+	if status, body := o.callback(t, query, cookie); status != fiber.StatusOK {
+		t.Fatalf("second sign-in: status %d: %v", status, body)
+	}
+	if n := countUsers(t); n != 1 {
+		t.Errorf("%d users, want 1", n)
+	}
+}
+
+func TestOIDCCallbackRejectsTamperedIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(claims jwt.MapClaims)
+	}{
+		{"wrong nonce", func(claims jwt.MapClaims) { claims["nonce"] = "not-the-nonce" }},
+		{"wrong audience", func(claims jwt.MapClaims) { claims["aud"] = "another-client" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOIDCTest(t)
+			o.fake.Tamper = tt.tamper
+
+			query, cookie := o.login(t)
+			status, body := o.callback(t, query, cookie)
+			if status != fiber.StatusUnauthorized {
+				t.Fatalf("status %d, want %d: %v", status, fiber.StatusUnauthorized, body)
+			}
+			if n := countUsers(t); n != 0 {
+				t.Errorf("%d users created, want 0", n)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	o := newOIDCTest(t)
+
+	// The victim's browser holds the cookie of its own attempt, the callback is the attacker's.
+	attackerQuery, _ := o.login(t)
+	_, victimCookie := o.login(t)
+
+	status, body := o.callback(t, attackerQuery, victimCookie)
+	if status != fiber.StatusBadRequest {
+		t.Fatalf("other attempt's cookie: status %d, want %d: %v", status, fiber.StatusBadRequest, body)
+	}
+	status, body = o.callback(t, attackerQuery, nil)
+	if status != fiber.StatusBadRequest {
+		t.Fatalf("no cookie: status %d, want %d: %v", status, fiber.StatusBadRequest, body)
+	}
+	if n := countUsers(t); n != 0 {
+		t.Errorf("%d users created, want 0", n)
+	}
+}
+
+func TestOIDCCallbackRefusesUnverifiedEmail(t *testing.T) {
+	o := newOIDCTest(t)
+	o.fake.SetUser(oidctest.User{Subject: "42", Email: "jane@example.com", EmailVerified: false, GivenName: "Jane"})
+
+	query, cookie := o.login(t)
+	status, body := o.callback(t, query, cookie)
+	if status != fiber.StatusForbidden {
+		t.Fatalf("status %d, want %d: %v", status, fiber.StatusForbidden, body)
+	}
+	if n := countUsers(t); n != 0 {
+		t.Errorf("%d users created, want 0", n)
+	}
+}
+
+func TestOIDCCallbackDoesNotLinkUnverifiedAccount(t *testing.T) {
+	o := newOIDCTest(t)
+
+	// Someone registered the address first, with a password of their choosing.
+	squatter := models.User{FirstName: "Mal", LastName: "Lory", Email: "jane@example.com", Password: []byte("$argon2id$...")}
+	if err := helpers.DB().Create(&squatter).Error; err != nil {
+		t.Fatal(err)
+	}
+	o.fake.SetUser(oidctest.User{Subject: "42", Email: "jane@example.com", EmailVerified: true, GivenName: "Jane"})
+
+	query, cookie := o.login(t)
+	status, body := o.callback(t, query, cookie)
+	if status != fiber.StatusForbidden {
+		t.Fatalf("status %d, want %d: %v", status, fiber.StatusForbidden, body)
+	}
+	var identities int64
+	helpers.DB().Model(&models.ExternalIdentity{}).Count(&identities)
+	if identities != 0 {
+		t.Errorf("%d identities linked, want 0", identities)
+	}
+}
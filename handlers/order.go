@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/amanguptak/fiber-api/auth"
+	"github.com/amanguptak/fiber-api/dtos"
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/amanguptak/fiber-api/repositories"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func CreateOrder(c *fiber.Ctx) error {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+
+	var orderDto dtos.CreateOrder
+
+	if err := c.BodyParser(&orderDto); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	validate := validator.New()
+
+	if err := validate.Struct(orderDto); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(helpers.FormatValidationErrors(err))
+	}
+
+	lines := make([]repositories.OrderLine, 0, len(orderDto.Items))
+	for _, item := range orderDto.Items {
+		lines = append(lines, repositories.OrderLine{
+			ProductID: uuid.MustParse(item.ProductId), // already checked by the "uuid" tag
+			Quantity:  item.Quantity,
+		})
+	}
+
+	// Every product must exist before we link an order to it.
+	order, err := repositories.CreateOrder(principal.UserID, lines)
+	if errors.Is(err, repositories.ErrProductNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, repositories.ErrInsufficientStock) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, models.ErrCurrencyMismatch) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "all items in an order must use the same currency"})
+	}
+	if errors.Is(err, models.ErrAmountOverflow) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "order total is too large"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create order"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(dtos.CreateResponseOrder(order))
+}
+
+func GetOrders(c *fiber.Ctx) error {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+
+	orders := []models.Order{}
+
+	if err := helpers.DB().Scopes(repositories.WithOrderDetails).
+		Where("user_id = ?", principal.UserID).
+		Order("created_at desc").
+		Find(&orders).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	responseOrders := make([]dtos.Order, 0, len(orders))
+	for _, order := range orders {
+		responseOrders = append(responseOrders, dtos.CreateResponseOrder(order))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(responseOrders)
+}
+
+// findOrder only returns orders owned by userID, so one user can never read another user's order.
+func findOrder(id string, userID uuid.UUID, order *models.Order) error {
+	helpers.DB().Scopes(repositories.WithOrderDetails).Find(order, "id = ? AND user_id = ?", id, userID)
+
+	if order.ID == uuid.Nil {
+		return errors.New("order does not exist")
+	}
+	return nil
+}
+
+func GetOrder(c *fiber.Ctx) error {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+
+	order := models.Order{}
+
+	if err := findOrder(c.Params("id"), principal.UserID, &order); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(dtos.CreateResponseOrder(order))
+}
+
+func UpdateOrderStatus(c *fiber.Ctx) error {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+
+	var statusDto dtos.UpdateOrderStatus
+
+	if err := c.BodyParser(&statusDto); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	validate := validator.New()
+
+	if err := validate.Struct(statusDto); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(helpers.FormatValidationErrors(err))
+	}
+
+	next := models.OrderStatus(statusDto.Status)
+
+	// Admins run the order lifecycle for everyone.
+	// Customers may only cancel, and only their own orders (findOrder checks ownership).
+	orderID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "order does not exist"})
+	}
+	if !principal.IsAdmin() {
+		if next != models.OrderCancelled {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "forbidden"})
+		}
+
+		order := models.Order{}
+		if err := findOrder(orderID.String(), principal.UserID, &order); err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	updated, err := repositories.TransitionOrder(orderID, principal.UserID, next)
+	if errors.Is(err, repositories.ErrIllegalTransition) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, repositories.ErrOrderNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update order status"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(dtos.CreateResponseOrder(updated))
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+
+	"github.com/amanguptak/fiber-api/config"
+	"github.com/amanguptak/fiber-api/dtos"
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/mailer"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/amanguptak/fiber-api/password"
+	"github.com/amanguptak/fiber-api/repositories"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ForgotPassword emails a password reset link. The answer is the same whether or not the
+// email belongs to an account, so this endpoint cannot be used to find out who is registered;
+// the per-account hourly limit is applied silently for the same reason.
+func ForgotPassword(c *fiber.Ctx) error {
+	var data dtos.ForgotPasswordRequest
+
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(helpers.FormatValidationErrors(err))
+	}
+
+	var user models.User
+	// Service accounts have no password on purpose, so they never get one this way either.
+	if err := helpers.DB().Where("email = ? AND service_account = ?", data.Email, false).First(&user).Error; err == nil {
+		token, err := repositories.CreatePasswordResetToken(user.ID)
+		if err != nil && !errors.Is(err, repositories.ErrResetRateLimited) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create reset token"})
+		}
+
+		// Send in the background: waiting for the mail server would make "account exists"
+		// measurably slower than "no such account".
+		if err == nil {
+			go sendPasswordResetEmail(user, token)
+		}
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "If an account exists for this email, a password reset link has been sent",
+	})
+}
+
+func sendPasswordResetEmail(user models.User, token string) {
+	link := config.App.BaseURL + "/reset-password?token=" + url.QueryEscape(token)
+	message := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your account. If it was you, open this link within %s:\n\n%s\n\nIf it was not you, ignore this email; your password stays the same.\n",
+			user.FirstName, config.App.PasswordResetTTL, link),
+	}
+	if err := mailer.Default.Send(message); err != nil {
+		log.Printf("password reset email to user %s failed: %v", user.ID, err)
+	}
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword.
+// All of the user's sessions are revoked, so they have to log in again everywhere.
+func ResetPassword(c *fiber.Ctx) error {
+	var data dtos.ResetPasswordRequest
+
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(helpers.FormatValidationErrors(err))
+	}
+
+	// The email is not known before the token is redeemed, so only the generic rules apply here.
+	if err := password.Validate(data.Password); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"Password": err.Error()})
+	}
+
+	passwordHash, err := password.Hash(data.Password)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not reset password"})
+	}
+
+	_, err = repositories.ResetPassword(data.Token, passwordHash)
+	if errors.Is(err, repositories.ErrResetTokenInvalid) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not reset password"})
+	}
+
+	clearRefreshCookie(c)
+	return c.JSON(fiber.Map{"message": "Password has been reset, please log in again"})
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/amanguptak/fiber-api/dtos"
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func CreateProduct(c *fiber.Ctx) error {
+	var productDto dtos.CreateProduct
+
+	if err := c.BodyParser(&productDto); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	validate := validator.New()
+
+	if err := validate.Struct(productDto); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(helpers.FormatValidationErrors(err))
+	}
+
+	price, err := models.NewMoney(*productDto.Price, productDto.Currency)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	product := models.Product{
+		Name:  productDto.Name,
+		Price: price,
+		Stock: productDto.Stock,
+	}
+
+	if err := helpers.DB().Create(&product).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create product"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(dtos.CreateResponseProduct(product))
+}
+
+// productSorts maps the ?sort= values we accept to ORDER BY clauses.
+// Only whitelisted values reach the query, so the client cannot inject SQL here.
+var productSorts = map[string]string{
+	"":       "created_at desc",
+	"newest": "created_at desc",
+	"price":  "CAST(price AS INTEGER) asc",
+	"-price": "CAST(price AS INTEGER) desc",
+	"name":   "name asc",
+}
+
+func GetProducts(c *fiber.Ctx) error {
+	products := []models.Product{}
+
+	order, ok := productSorts[c.Query("sort")]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "sort must be one of newest, price, -price, name"})
+	}
+
+	if err := helpers.DB().Order(order).Find(&products).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	responseProducts := make([]dtos.Product, 0, len(products))
+	for _, product := range products {
+		responseProducts = append(responseProducts, dtos.CreateResponseProduct(product))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(responseProducts)
+}
+
+// findProduct works like findUser: it fills the struct and reports a missing row as an error.
+func findProduct(id string, product *models.Product) error {
+	helpers.DB().Find(product, "id = ?", id)
+
+	if product.ID == uuid.Nil {
+		return errors.New("product does not exist")
+	}
+	return nil
+}
+
+func GetProduct(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	product := models.Product{}
+
+	if err := findProduct(id, &product); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(dtos.CreateResponseProduct(product))
+}
+
+func UpdateProduct(c *fiber.Ctx) error {
+	id := c.Params("id")
+	updatedProduct := dtos.UpdateProduct{}
+
+	if err := c.BodyParser(&updatedProduct); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	validate := validator.New()
+
+	if err := validate.Struct(updatedProduct); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(helpers.FormatValidationErrors(err))
+	}
+
+	product := models.Product{}
+
+	if err := findProduct(id, &product); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Only touch the fields that were actually sent in the JSON
+	if updatedProduct.Name != nil {
+		product.Name = *updatedProduct.Name
+	}
+	if updatedProduct.Price != nil || updatedProduct.Currency != nil {
+		amount, currency := product.Price.Amount, product.Price.Currency
+		if updatedProduct.Price != nil {
+			amount = *updatedProduct.Price
+		}
+		if updatedProduct.Currency != nil {
+			currency = *updatedProduct.Currency
+		}
+
+		price, err := models.NewMoney(amount, currency)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		product.Price = price
+	}
+	if updatedProduct.Stock != nil {
+		product.Stock = *updatedProduct.Stock
+	}
+
+	if err := helpers.DB().Save(&product).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update product"})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(dtos.CreateResponseProduct(product))
+}
+
+func DeleteProduct(c *fiber.Ctx) error {
+	id := c.Params("id")
+	product := models.Product{}
+
+	if err := findProduct(id, &product); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := helpers.DB().Delete(&product).Error; err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Product deleted successfully"})
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/amanguptak/fiber-api/auth"
+	"github.com/amanguptak/fiber-api/dtos"
+	"github.com/amanguptak/fiber-api/repositories"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// currentSessionID is the session whose access token authenticated this request, or uuid.Nil.
+// Not the refresh cookie: it is scoped to /api/auth and never reaches these routes. Only a
+// session of the given user counts, so an admin's own session is never marked in a user's list.
+func currentSessionID(c *fiber.Ctx, userID uuid.UUID) uuid.UUID {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok || principal.TokenID == "" {
+		return uuid.Nil
+	}
+	sessionID, err := repositories.SessionIDForAccessToken(userID, principal.TokenID)
+	if err != nil {
+		return uuid.Nil
+	}
+	return sessionID
+}
+
+func listSessions(c *fiber.Ctx, userID uuid.UUID) error {
+	sessions, err := repositories.ListSessions(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	currentID := currentSessionID(c, userID)
+	responseSessions := make([]dtos.Session, 0, len(sessions))
+	for _, session := range sessions {
+		responseSessions = append(responseSessions, dtos.CreateResponseSession(session, currentID))
+	}
+	return c.Status(fiber.StatusOK).JSON(responseSessions)
+}
+
+func revokeSession(c *fiber.Ctx, userID uuid.UUID, param string) error {
+	sessionID, err := uuid.Parse(c.Params(param))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": repositories.ErrSessionNotFound.Error()})
+	}
+
+	err = repositories.RevokeSession(userID, sessionID)
+	if errors.Is(err, repositories.ErrSessionNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not revoke session"})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Session revoked"})
+}
+
+// GetSessions lists the caller's active logins.
+func GetSessions(c *fiber.Ctx) error {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+	return listSessions(c, principal.UserID)
+}
+
+// RevokeSession logs the caller out on one device.
+func RevokeSession(c *fiber.Ctx) error {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+	return revokeSession(c, principal.UserID, "id")
+}
+
+// RevokeOtherSessions logs the caller out everywhere except the session of this request's access token.
+func RevokeOtherSessions(c *fiber.Ctx) error {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+
+	currentID := currentSessionID(c, principal.UserID)
+	if currentID == uuid.Nil {
+		// Without it we cannot tell which session to keep, and revoking all of them is not what was asked.
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "current session unknown: log in again"})
+	}
+
+	revoked, err := repositories.RevokeOtherSessions(principal.UserID, currentID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not revoke sessions"})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Other sessions revoked", "revoked": revoked})
+}
+
+// GetUserSessions lists the active logins of the user in :id (admin).
+func GetUserSessions(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user does not exist"})
+	}
+	return listSessions(c, userID)
+}
+
+// RevokeUserSession ends one session of the user in :id (admin).
+func RevokeUserSession(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user does not exist"})
+	}
+	return revokeSession(c, userID, "sessionId")
+}
+
+// RevokeUserSessions ends every session of the user in :id (admin), e.g. after an account compromise.
+func RevokeUserSessions(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user does not exist"})
+	}
+
+	revoked, err := repositories.RevokeOtherSessions(userID, uuid.Nil)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not revoke sessions"})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Sessions revoked", "revoked": revoked})
+}
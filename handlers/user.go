@@ -3,6 +3,7 @@ package handlers
 import (
 	"errors"
 
+	"github.com/amanguptak/fiber-api/auth"
 	"github.com/amanguptak/fiber-api/dtos"
 	"github.com/amanguptak/fiber-api/helpers"
 	"github.com/amanguptak/fiber-api/models"
@@ -161,6 +162,14 @@ func UpdateUser(c *fiber.Ctx) error {
 	if updatedUser.LastName != nil {
 		user.LastName = *updatedUser.LastName
 	}
+
+	// Changing a role is an admin action, even on your own account.
+	if updatedUser.Role != nil {
+		if principal, _ := auth.PrincipalFrom(c); !principal.IsAdmin() {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "forbidden"})
+		}
+		user.Role = models.Role(*updatedUser.Role)
+	}
 	helpers.DB().Save(&user)
 	responseUser := dtos.CreateResponseUser(user)
 	return c.Status(fiber.StatusOK).JSON(responseUser)
@@ -186,3 +195,19 @@ func DeleteUser(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "User deleted successfully"})
 
 }
+
+// GetMe returns the caller's own account, using the principal IsAuthenticated put in c.Locals.
+func GetMe(c *fiber.Ctx) error {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+
+	user := models.User{}
+
+	if err := findUser(principal.UserID.String(), &user); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(err.Error())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(dtos.CreateResponseUser(user))
+}
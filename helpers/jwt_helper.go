@@ -1,28 +1,122 @@
 package helpers
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/amanguptak/fiber-api/config"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-const SecretKey = "secret"
+// TokenType is the "typ" claim. It stops a token minted for one purpose being used for another,
+// e.g. a 7-day refresh token sent as a bearer token.
+type TokenType string
+
+const (
+	AccessToken  TokenType = "access"
+	RefreshToken TokenType = "refresh"
+	// MFAPendingToken proves the password was right; only /api/login/mfa accepts it, together with a TOTP code.
+	MFAPendingToken TokenType = "mfa_pending"
+	// MagicLinkToken is the login link emailed by /api/magic-link; only /api/magic-link/consume accepts it.
+	MagicLinkToken TokenType = "magic_link"
+)
+
+// Claims is the payload of every token we sign.
+// The user id lives in "sub"; "iss" and "aud" name us (config JWT_ISSUER / JWT_AUDIENCE),
+// "jti" makes every token unique and "iat" records when it was issued.
+type Claims struct {
+	Type TokenType `json:"typ"`
+	Role string    `json:"role,omitempty"`
+	// ClientID and Scope are only set on tokens from /oauth/token: the OAuth client they were
+	// issued to and the space-separated scopes they carry (RFC 9068 names).
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GenerateToken signs a token of the given type for a user. "role" travels in the token so
+// middleware.RequireRole can gate routes without a database lookup on every request.
+// The token is signed with the active key from the key set, and its "kid" header names that key.
+func GenerateToken(tokenType TokenType, subject string, role string, expirationTime time.Time) (string, error) {
+	token, _, err := IssueToken(tokenType, subject, role, expirationTime)
+	return token, err
+}
 
-func GenerateToken(issuer string, expirationTime time.Time) (string, error) {
-	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"iss": issuer,
-		"exp": expirationTime.Unix(),
-	})
+// IssueToken is GenerateToken that also returns the signed claims, for callers that need to
+// remember the token's jti (e.g. to denylist an access token later).
+func IssueToken(tokenType TokenType, subject string, role string, expirationTime time.Time) (string, *Claims, error) {
+	return IssueClientToken(tokenType, subject, role, "", nil, expirationTime)
+}
 
-	return claims.SignedString([]byte(SecretKey))
+// IssueClientToken is IssueToken for an OAuth client: the token also names the client and
+// carries the scopes it was granted.
+func IssueClientToken(tokenType TokenType, subject string, role string, clientID string, scopes []string, expirationTime time.Time) (string, *Claims, error) {
+	key := currentKeySet().signing
+
+	claims := Claims{
+		Type:     tokenType,
+		Role:     role,
+		ClientID: clientID,
+		Scope:    strings.Join(scopes, " "),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.App.JWTIssuer,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{config.App.JWTAudience},
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.NewString(),
+		},
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	signed, err := token.SignedString(key.signKey)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, &claims, nil
 }
 
-func ParseToken(tokenString string) (*jwt.Token, error) {
-	return jwt.ParseWithClaims(tokenString, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(SecretKey), nil
-	})
+// ParseToken verifies a token against the key named by its "kid" header and checks that it is
+// the expected type and was issued by and for us. WithValidMethods makes the parser refuse any
+// alg we do not use (including "none") before the key lookup even runs.
+func ParseToken(tokenString string, expected TokenType) (*Claims, error) {
+	set := currentKeySet()
+
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, set.Lookup,
+		jwt.WithValidMethods(set.Algorithms()),
+		jwt.WithIssuer(config.App.JWTIssuer),
+		jwt.WithAudience(config.App.JWTAudience),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	if claims.Type != expected {
+		return nil, fmt.Errorf("expected a %s token, got %q", expected, claims.Type)
+	}
+	if claims.Subject == "" || claims.ID == "" {
+		return nil, errors.New("token is missing sub or jti")
+	}
+	return claims, nil
 }
 
+// ClaimsFromHeader verifies the bearer access token in an Authorization header and returns its claims.
+func ClaimsFromHeader(authHeader string) (*Claims, error) {
+	tokenString, found := strings.CutPrefix(authHeader, "Bearer ")
+	if !found || tokenString == "" {
+		return nil, errors.New("missing bearer token")
+	}
+
+	return ParseToken(tokenString, AccessToken)
+}
 
 // This function is the "Security Guard" of your app. It checks if a token is Real or Fake.
 
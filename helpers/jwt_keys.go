@@ -0,0 +1,322 @@
+package helpers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+
+	"github.com/amanguptak/fiber-api/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one key we can verify tokens with, and sign with if we hold the private half.
+// ID goes into the token's "kid" header so the verifier knows which key to use.
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{} // nil for verify-only keys (e.g. the public half of a rotated-out key)
+	verifyKey interface{}
+}
+
+// CanSign reports whether we hold the private (or HMAC) key.
+func (key *SigningKey) CanSign() bool {
+	return key.signKey != nil
+}
+
+// KeySet is the active signing key plus every key we still accept during rotation.
+type KeySet struct {
+	signing *SigningKey
+	byID    map[string]*SigningKey
+}
+
+// NewKeySet builds a key set. signing is used for new tokens; verifyOnly keys are only
+// accepted on incoming tokens, so tokens signed before a rotation stay valid until they expire.
+func NewKeySet(signing *SigningKey, verifyOnly ...*SigningKey) (*KeySet, error) {
+	if signing == nil || !signing.CanSign() {
+		return nil, errors.New("the active signing key must include its private key")
+	}
+
+	set := &KeySet{signing: signing, byID: map[string]*SigningKey{signing.ID: signing}}
+	for _, key := range verifyOnly {
+		if _, exists := set.byID[key.ID]; exists {
+			continue
+		}
+		set.byID[key.ID] = key
+	}
+	return set, nil
+}
+
+// Lookup picks the key for a parsed token by its "kid" header.
+// The token's "alg" must be exactly the algorithm of that key. This is what stops
+// "alg confusion" attacks, e.g. a token claiming HS256 signed with our public RSA key as the secret.
+func (set *KeySet) Lookup(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := set.byID[kid]
+	if !ok && kid == "" && set.signing.Method == jwt.SigningMethodHS256 {
+		// Tokens issued before we added "kid" headers were all signed with the HMAC secret.
+		key, ok = set.signing, true
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q for key %q", token.Method.Alg(), kid)
+	}
+	return key.verifyKey, nil
+}
+
+// Algorithms lists every alg we accept, for jwt.WithValidMethods.
+func (set *KeySet) Algorithms() []string {
+	seen := map[string]bool{}
+	var algs []string
+	for _, key := range set.byID {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+var (
+	keySetMu sync.RWMutex
+	keySet   *KeySet
+)
+
+// SetKeySet replaces the keys used by GenerateToken and ParseToken.
+func SetKeySet(set *KeySet) {
+	keySetMu.Lock()
+	defer keySetMu.Unlock()
+	keySet = set
+}
+
+// currentKeySet returns the loaded keys. Before LoadSigningKeys runs it falls back to
+// HS256 with config.App.JWTSecret, which is what the app always did.
+func currentKeySet() *KeySet {
+	keySetMu.RLock()
+	set := keySet
+	keySetMu.RUnlock()
+	if set != nil {
+		return set
+	}
+
+	set, _ = NewKeySet(NewHMACKey([]byte(config.App.JWTSecret)))
+	return set
+}
+
+// LoadSigningKeys builds the key set described by the config and installs it.
+//
+//   - HS256: one shared secret (JWT_SECRET). Nothing is published in the JWKS.
+//   - RS256 / EdDSA: the private key in JWT_PRIVATE_KEY_FILE signs, and the public keys (or private
+//     keys) in JWT_VERIFY_KEY_FILES are still accepted. To rotate, move the old key into the verify list.
+func LoadSigningKeys(cfg config.Config) error {
+	if cfg.JWTAlgorithm == "HS256" {
+		set, err := NewKeySet(NewHMACKey([]byte(cfg.JWTSecret)))
+		if err != nil {
+			return err
+		}
+		SetKeySet(set)
+		return nil
+	}
+
+	var signing *SigningKey
+	if cfg.JWTPrivateKeyFile == "" {
+		// config.Validate only allows this outside production.
+		log.Printf("JWT_PRIVATE_KEY_FILE is not set: using a throwaway %s key, tokens will not survive a restart", cfg.JWTAlgorithm)
+		key, err := GenerateSigningKey(cfg.JWTAlgorithm)
+		if err != nil {
+			return err
+		}
+		signing = key
+	} else {
+		data, err := os.ReadFile(cfg.JWTPrivateKeyFile)
+		if err != nil {
+			return fmt.Errorf("JWT_PRIVATE_KEY_FILE: %w", err)
+		}
+		if signing, err = ParseKeyPEM(data); err != nil {
+			return fmt.Errorf("JWT_PRIVATE_KEY_FILE: %w", err)
+		}
+		if signing.Method.Alg() != cfg.JWTAlgorithm {
+			return fmt.Errorf("JWT_PRIVATE_KEY_FILE holds a %s key but JWT_ALG is %s", signing.Method.Alg(), cfg.JWTAlgorithm)
+		}
+	}
+
+	var verifyOnly []*SigningKey
+	for _, path := range cfg.JWTVerifyKeyFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("JWT_VERIFY_KEY_FILES: %w", err)
+		}
+		key, err := ParseKeyPEM(data)
+		if err != nil {
+			return fmt.Errorf("JWT_VERIFY_KEY_FILES %s: %w", path, err)
+		}
+		verifyOnly = append(verifyOnly, key)
+	}
+
+	set, err := NewKeySet(signing, verifyOnly...)
+	if err != nil {
+		return err
+	}
+	SetKeySet(set)
+	return nil
+}
+
+// NewHMACKey wraps a shared secret. Its kid is derived from the secret's hash, never the secret itself.
+func NewHMACKey(secret []byte) *SigningKey {
+	sum := sha256.Sum256(secret)
+	return &SigningKey{
+		ID:        "hs256-" + hex.EncodeToString(sum[:4]),
+		Method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+// GenerateSigningKey makes a fresh RS256 or EdDSA key pair.
+func GenerateSigningKey(alg string) (*SigningKey, error) {
+	switch alg {
+	case "RS256":
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		return newAsymmetricKey(private, &private.PublicKey)
+	case "EdDSA":
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return newAsymmetricKey(private, public)
+	default:
+		return nil, fmt.Errorf("cannot generate a key for %q", alg)
+	}
+}
+
+// ParseKeyPEM reads an RSA or Ed25519 key. A private key can sign and verify;
+// a public key can only verify. The algorithm follows from the key type.
+func ParseKeyPEM(data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if private, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		switch private := private.(type) {
+		case *rsa.PrivateKey:
+			return newAsymmetricKey(private, &private.PublicKey)
+		case ed25519.PrivateKey:
+			return newAsymmetricKey(private, private.Public())
+		default:
+			return nil, fmt.Errorf("unsupported private key type %T", private)
+		}
+	}
+	if private, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return newAsymmetricKey(private, &private.PublicKey)
+	}
+	if public, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return newAsymmetricKey(nil, public)
+	}
+	if public, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return newAsymmetricKey(nil, public)
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+func newAsymmetricKey(private interface{}, public interface{}) (*SigningKey, error) {
+	key := &SigningKey{verifyKey: public}
+	if private != nil {
+		key.signKey = private
+	}
+
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", public)
+	}
+
+	jwk, err := publicJWK(key)
+	if err != nil {
+		return nil, err
+	}
+	key.ID = thumbprint(jwk)
+	return key, nil
+}
+
+// JWK is one public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWKS returns the public keys other services need to verify our tokens.
+// HMAC secrets are never included.
+func PublicJWKS() JWKSet {
+	set := currentKeySet()
+
+	jwks := JWKSet{Keys: []JWK{}}
+	for _, key := range set.byID {
+		jwk, err := publicJWK(key)
+		if err != nil {
+			continue
+		}
+		jwk.Kid = key.ID
+		jwk.Use = "sig"
+		jwk.Alg = key.Method.Alg()
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
+
+func publicJWK(key *SigningKey) (JWK, error) {
+	encode := base64.RawURLEncoding.EncodeToString
+
+	switch public := key.verifyKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{Kty: "RSA", N: encode(public.N.Bytes()), E: encode(big.NewInt(int64(public.E)).Bytes())}, nil
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: encode(public)}, nil
+	default:
+		return JWK{}, errors.New("not a public key")
+	}
+}
+
+// thumbprint is the RFC 7638 JWK thumbprint: the same public key always gets the same kid.
+func thumbprint(jwk JWK) string {
+	var canonical string
+	if jwk.Kty == "RSA" {
+		canonical = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk.E, jwk.N)
+	} else {
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"OKP","x":"%s"}`, jwk.Crv, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
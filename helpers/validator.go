@@ -1,6 +1,10 @@
 package helpers
 
-import "github.com/go-playground/validator/v10"
+import (
+	"reflect"
+
+	"github.com/go-playground/validator/v10"
+)
 
 func FormatValidationErrors(err error) map[string]string {
 	errors := make(map[string]string)
@@ -17,11 +21,19 @@ func FormatValidationErrors(err error) map[string]string {
 		case "required":
 			errors[field] = field + " is required"
 		case "min":
-			errors[field] = field + " must be at least " + fieldError.Param() + " characters"
+			errors[field] = field + " must be at least " + fieldError.Param() + unitFor(fieldError.Kind())
 		case "max":
-			errors[field] = field + " must be at most " + fieldError.Param() + " characters"
+			errors[field] = field + " must be at most " + fieldError.Param() + unitFor(fieldError.Kind())
 		case "email":
 			errors[field] = field + " must be a valid email"
+		case "numeric":
+			errors[field] = field + " must be a number"
+		case "iso4217":
+			errors[field] = field + " must be a 3-letter ISO 4217 currency code"
+		case "oneof":
+			errors[field] = field + " must be one of: " + fieldError.Param()
+		case "uuid":
+			errors[field] = field + " must be a valid UUID"
 		default:
 			errors[field] = field + " is invalid"
 		}
@@ -29,3 +41,16 @@ func FormatValidationErrors(err error) map[string]string {
 
 	return errors
 }
+
+// unitFor says what a min/max limit counts: characters for strings, items for lists,
+// and nothing for plain numbers like a quantity.
+func unitFor(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return " items"
+	default:
+		return ""
+	}
+}
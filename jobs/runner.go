@@ -0,0 +1,162 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Job is a piece of housekeeping that runs in the background every Interval.
+// Run returns a short summary of what it did (e.g. "purged 12 refresh tokens") for the status endpoint.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) (string, error)
+}
+
+// Status is what we know about a job's most recent run.
+type Status struct {
+	Name           string
+	Interval       time.Duration
+	Running        bool
+	Runs           int
+	LastStartedAt  time.Time
+	LastFinishedAt time.Time
+	LastDuration   time.Duration
+	LastResult     string
+	LastError      string
+	NextRunAt      time.Time
+}
+
+// Runner runs jobs on their own tickers inside the server process.
+// Each job runs once right after Start and then every Interval; a run never overlaps the previous one.
+type Runner struct {
+	mu       sync.Mutex
+	jobs     []Job
+	statuses map[string]*Status
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// Default is the runner started by main and read by the jobs status endpoint.
+var Default = NewRunner()
+
+func NewRunner() *Runner {
+	return &Runner{statuses: map[string]*Status{}}
+}
+
+// Add registers a job. Jobs added after Start are not run.
+func (r *Runner) Add(job Job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.jobs = append(r.jobs, job)
+	r.statuses[job.Name] = &Status{Name: job.Name, Interval: job.Interval}
+}
+
+// Start launches one goroutine per job. They stop when ctx is cancelled or Stop is called.
+func (r *Runner) Start(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel != nil {
+		return // already running
+	}
+	ctx, r.cancel = context.WithCancel(ctx)
+
+	for _, job := range r.jobs {
+		r.wg.Add(1)
+		go r.loop(ctx, job)
+	}
+}
+
+// Stop cancels all jobs and waits for a run in progress to finish.
+func (r *Runner) Stop() {
+	r.mu.Lock()
+	cancel := r.cancel
+	r.cancel = nil
+	r.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	r.wg.Wait()
+}
+
+// Statuses returns a copy of every job's status, sorted by name.
+func (r *Runner) Statuses() []Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	statuses := make([]Status, 0, len(r.statuses))
+	for _, status := range r.statuses {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+func (r *Runner) loop(ctx context.Context, job Job) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		r.runOnce(ctx, job)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Runner) runOnce(ctx context.Context, job Job) {
+	started := time.Now()
+	r.update(job.Name, func(status *Status) {
+		status.Running = true
+		status.LastStartedAt = started
+	})
+
+	result, err := r.safeRun(ctx, job)
+
+	finished := time.Now()
+	r.update(job.Name, func(status *Status) {
+		status.Running = false
+		status.Runs++
+		status.LastFinishedAt = finished
+		status.LastDuration = finished.Sub(started)
+		status.LastResult = result
+		status.LastError = ""
+		if err != nil {
+			status.LastError = err.Error()
+		}
+		status.NextRunAt = started.Add(job.Interval)
+	})
+
+	if err != nil {
+		log.Printf("job %s failed: %v", job.Name, err)
+	}
+}
+
+// safeRun keeps a panicking job from taking the whole server down with it.
+func (r *Runner) safeRun(ctx context.Context, job Job) (result string, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+func (r *Runner) update(name string, change func(status *Status)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change(r.statuses[name])
+}
@@ -0,0 +1,80 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/amanguptak/fiber-api/repositories"
+)
+
+// TokenCleanup purges expired refresh tokens and revoked ones older than retention,
+// expired entries of the access token denylist, used or expired password reset and
+// email verification tokens, login links, and abandoned identity provider sign-ins.
+// Without it the refresh_tokens table grows forever, because rotation and logout only flip IsRevoked.
+func TokenCleanup(interval time.Duration, retention time.Duration) Job {
+	return Job{
+		Name:     "token-cleanup",
+		Interval: interval,
+		Run: func(ctx context.Context) (string, error) {
+			now := time.Now()
+			purged, err := repositories.PurgeRefreshTokens(now, retention)
+			if err != nil {
+				return "", err
+			}
+			// Denylisted access tokens only need to be remembered until they expire.
+			unlisted, err := repositories.PurgeRevokedAccessTokens(now)
+			if err != nil {
+				return "", err
+			}
+			resets, err := repositories.PurgePasswordResetTokens(now)
+			if err != nil {
+				return "", err
+			}
+			verifications, err := repositories.PurgeEmailVerificationTokens(now)
+			if err != nil {
+				return "", err
+			}
+			magicLinks, err := repositories.PurgeMagicLinks(now)
+			if err != nil {
+				return "", err
+			}
+			signIns, err := repositories.PurgeOIDCLoginStates(now)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("purged %d refresh tokens, %d revoked access tokens, %d password reset and %d email verification tokens, %d login links, %d sign-in states",
+				purged, unlisted, resets, verifications, magicLinks, signIns), nil
+		},
+	}
+}
+
+// LoginThrottleCleanup deletes failed-login counters that are no longer locked or recent.
+func LoginThrottleCleanup(interval time.Duration) Job {
+	return Job{
+		Name:     "login-throttle-cleanup",
+		Interval: interval,
+		Run: func(ctx context.Context) (string, error) {
+			purged, err := repositories.PurgeLoginThrottles(time.Now())
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("purged %d login throttles", purged), nil
+		},
+	}
+}
+
+// DummyPasswordHash re-checks which hash algorithms are still stored, so the dummy hash for
+// unknown emails gets faster again once the last old hash has been upgraded at login.
+func DummyPasswordHash(interval time.Duration) Job {
+	return Job{
+		Name:     "dummy-password-hash",
+		Interval: interval,
+		Run: func(ctx context.Context) (string, error) {
+			if err := repositories.RefreshDummyPasswordHash(); err != nil {
+				return "", err
+			}
+			return "refreshed dummy password hash", nil
+		},
+	}
+}
@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogMailer does not send anything: it prints each email to the server log, or appends it
+// to File when set. Good for local development, where you copy the link out of the log.
+type LogMailer struct {
+	From string
+	File string
+}
+
+// fileMu keeps emails sent at the same time from interleaving in File.
+var fileMu sync.Mutex
+
+func (m LogMailer) Send(message Message) error {
+	text := fmt.Sprintf("From: %s\nTo: %s\nDate: %s\nSubject: %s\n\n%s\n", m.From, message.To, time.Now().Format(time.RFC1123Z), message.Subject, message.Body)
+
+	if m.File == "" {
+		log.Printf("mail (not sent, MAILER=log):\n%s", text)
+		return nil
+	}
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	file, err := os.OpenFile(m.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(text + "\n----\n")
+	return err
+}
@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"fmt"
+
+	"github.com/amanguptak/fiber-api/config"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails. Swap the implementation with config MAILER: "log" for local
+// development, "smtp" for a real mail server.
+type Mailer interface {
+	Send(message Message) error
+}
+
+// Default is the mailer the handlers send through. It is set by Setup in main.
+var Default Mailer = LogMailer{}
+
+// Setup builds the mailer named by cfg.Mailer and stores it in Default.
+func Setup(cfg config.Config) error {
+	switch cfg.Mailer {
+	case config.MailerSMTP:
+		Default = SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		}
+	case config.MailerLog:
+		Default = LogMailer{From: cfg.MailFrom, File: cfg.MailFile}
+	default:
+		return fmt.Errorf("unknown mailer %q", cfg.Mailer)
+	}
+	return nil
+}
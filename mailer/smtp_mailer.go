@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPMailer sends email through an SMTP server. net/smtp upgrades to TLS with STARTTLS when
+// the server offers it, and refuses PLAIN auth over an unencrypted connection to a remote host.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string // empty: send without AUTH
+	Password string
+	From     string
+}
+
+func (m SMTPMailer) Send(message Message) error {
+	// Header injection: a recipient or subject with a line break could add headers of its own.
+	if strings.ContainsAny(message.To, "\r\n") || strings.ContainsAny(message.Subject, "\r\n") {
+		return fmt.Errorf("mail header contains a line break")
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	headers := []string{
+		"From: " + m.From,
+		"To: " + message.To,
+		"Subject: " + mime.QEncoding.Encode("utf-8", message.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+	}
+	body := strings.ReplaceAll(message.Body, "\n", "\r\n")
+	data := []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + body + "\r\n")
+
+	return smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, m.From, []string{message.To}, data)
+}
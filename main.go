@@ -1,18 +1,78 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/amanguptak/fiber-api/config"
 	"github.com/amanguptak/fiber-api/database"
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/jobs"
+	"github.com/amanguptak/fiber-api/mailer"
+	"github.com/amanguptak/fiber-api/oidc"
+	"github.com/amanguptak/fiber-api/password"
+	"github.com/amanguptak/fiber-api/repositories"
 
 	"github.com/amanguptak/fiber-api/routes"
 	"github.com/gofiber/fiber/v2"
 )
 
 func main() {
+	// Load settings first: the database path, JWT secret and port all come from here.
+	if _, err := config.Load(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := helpers.LoadSigningKeys(config.App); err != nil {
+		log.Fatal("failed to load JWT signing keys: ", err)
+	}
+
+	if err := password.Setup(config.App); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := mailer.Setup(config.App); err != nil {
+		log.Fatal(err)
+	}
+
+	oidc.Setup(config.App)
+
 	database.ConnectDb()
+	if err := repositories.LoadAccessTokenDenylist(); err != nil {
+		log.Fatal("failed to load access token denylist: ", err)
+	}
+	if err := repositories.RefreshDummyPasswordHash(); err != nil {
+		log.Fatal("failed to check stored password hashes: ", err)
+	}
 	app := fiber.New()
 	routes.SetupRoutes(app)
 
-	log.Fatal(app.Listen(":8000"))
+	// Background jobs run until we get SIGINT/SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if config.App.TokenCleanupInterval > 0 {
+		jobs.Default.Add(jobs.TokenCleanup(config.App.TokenCleanupInterval, config.App.RevokedTokenRetention))
+		jobs.Default.Add(jobs.LoginThrottleCleanup(config.App.TokenCleanupInterval))
+		jobs.Default.Add(jobs.DummyPasswordHash(config.App.TokenCleanupInterval))
+	}
+	jobs.Default.Start(ctx)
+
+	go func() {
+		<-ctx.Done()
+		log.Println("Shutting down")
+		if err := app.Shutdown(); err != nil {
+			log.Println("shutdown: ", err)
+		}
+	}()
+
+	if err := app.Listen(config.App.Addr()); err != nil {
+		log.Fatal(err)
+	}
+
+	// Listen returns once Shutdown has drained the open requests; let a running job finish too.
+	jobs.Default.Stop()
 }
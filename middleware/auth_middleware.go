@@ -1,24 +1,100 @@
 package middleware
 
 import (
+	"strings"
+
+	"github.com/amanguptak/fiber-api/auth"
+	"github.com/amanguptak/fiber-api/config"
 	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/amanguptak/fiber-api/repositories"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
+// IsAuthenticated accepts either a bearer access token from /api/login or a personal API key
+// in the X-API-Key header, and stores who is calling as an auth.Principal.
 func IsAuthenticated(c *fiber.Ctx) error {
-
-	authHeader := c.Get("Authorization") //  Get from Authorization header
-	if authHeader == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	if key := c.Get("X-API-Key"); key != "" {
+		return authenticateAPIKey(c, key)
 	}
-	tokenString := authHeader[7:]
-	token, err := helpers.ParseToken(tokenString)
 
-	if err != nil || !token.Valid {
+	// Get from Authorization header and verify it in one go.
+	// Only access tokens pass: a refresh token (typ "refresh") is rejected here.
+	claims, err := helpers.ClaimsFromHeader(c.Get("Authorization"))
+	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "unauthenticated",
 		})
 	}
 
+	// A valid signature is not enough: logout and "revoke session" denylist the token's jti.
+	if repositories.IsAccessTokenRevoked(claims.ID) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+
+	// Tokens from /oauth/token carry the client and its scopes, and are checked like an API key.
+	if claims.ClientID != "" {
+		principal := auth.Principal{
+			UserID:         userID,
+			Role:           models.Role(claims.Role),
+			Scopes:         strings.Fields(claims.Scope),
+			ClientID:       claims.ClientID,
+			ServiceAccount: true,
+			TokenID:        claims.ID,
+		}
+		if principal.Scopes == nil {
+			principal.Scopes = []string{}
+		}
+		if principal.IsAdmin() && !principal.HasScope(auth.ScopeAdmin) {
+			principal.Role = models.RoleCustomer
+		}
+		auth.SetPrincipal(c, principal)
+		return c.Next()
+	}
+
+	role := models.Role(claims.Role)
+	// With REQUIRE_ADMIN_MFA, an admin who has not turned on two-factor authentication is treated
+	// as a customer: they can still enroll (POST /api/mfa/totp/enroll), but not use admin powers.
+	// Confirming TOTP revokes the other sessions and every later login needs a code, so from then
+	// on an admin token came through the second factor. If we cannot tell, admin rights are withheld.
+	if role == models.RoleAdmin && config.App.RequireAdminMFA {
+		if hasTOTP, err := repositories.HasTOTP(userID); err != nil || !hasTOTP {
+			role = models.RoleCustomer
+		}
+	}
+
+	// Keep the caller for the handlers instead of throwing the claims away.
+	// Handlers read it back with auth.PrincipalFrom(c).
+	auth.SetPrincipal(c, auth.Principal{UserID: userID, Role: role, TokenID: claims.ID})
+
+	return c.Next()
+}
+
+func authenticateAPIKey(c *fiber.Ctx, key string) error {
+	apiKey, user, err := repositories.ResolveAPIKey(key)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+
+	principal := auth.Principal{
+		UserID:         user.ID,
+		Role:           user.Role,
+		Scopes:         apiKey.ScopeList(),
+		APIKeyID:       apiKey.ID,
+		ServiceAccount: user.ServiceAccount,
+	}
+	// An admin's key acts as a customer unless it was explicitly given the "admin" scope,
+	// so a key made for a reporting script cannot change roles or delete users.
+	if principal.IsAdmin() && !principal.HasScope(auth.ScopeAdmin) {
+		principal.Role = models.RoleCustomer
+	}
+
+	auth.SetPrincipal(c, principal)
 	return c.Next()
 }
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"github.com/amanguptak/fiber-api/auth"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireRole lets the request through only if the caller's role is one of roles.
+// It must run after IsAuthenticated:
+//
+//	api.Post("/products", middleware.RequireRole(models.RoleAdmin), handlers.CreateProduct)
+func RequireRole(roles ...models.Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := auth.PrincipalFrom(c)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+		}
+
+		for _, allowed := range roles {
+			if principal.Role == allowed {
+				return c.Next()
+			}
+		}
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "forbidden"})
+	}
+}
+
+// RequireSelfOrAdmin lets admins act on any user, and everyone else only on the user id
+// in the route parameter param that matches their own, e.g. /users/:id.
+func RequireSelfOrAdmin(param string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := auth.PrincipalFrom(c)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+		}
+
+		if principal.IsAdmin() || principal.UserID.String() == c.Params(param) {
+			return c.Next()
+		}
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "forbidden"})
+	}
+}
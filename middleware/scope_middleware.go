@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"github.com/amanguptak/fiber-api/auth"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireScope lets the request through only if the caller's credential carries scope.
+// Logins have no scope list and always pass; API keys and OAuth client tokens only with the scope.
+// It must run after IsAuthenticated:
+//
+//	api.Get("/orders", middleware.RequireScope(auth.ScopeOrdersRead), handlers.GetOrders)
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := auth.PrincipalFrom(c)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+		}
+
+		if principal.HasScope(scope) {
+			return c.Next()
+		}
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "forbidden"})
+	}
+}
+
+// RequireLogin rejects API keys and OAuth client tokens, for routes that manage credentials
+// themselves (sessions, two-factor authentication, API keys, OAuth clients). A leaked key must
+// not be able to mint new keys or turn off 2FA, so those need a real login.
+func RequireLogin(c *fiber.Ctx) error {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+
+	if principal.ViaAPIKey() || principal.ViaOAuthClient() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "forbidden"})
+	}
+	return c.Next()
+}
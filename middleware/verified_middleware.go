@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"github.com/amanguptak/fiber-api/auth"
+	"github.com/amanguptak/fiber-api/config"
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireVerifiedEmail blocks callers whose email is not verified yet, unless
+// REQUIRE_VERIFIED_EMAIL is "none". Use it after IsAuthenticated.
+// The flag is read from the database, not the token, so it takes effect right after verifying.
+func RequireVerifiedEmail(c *fiber.Ctx) error {
+	if config.App.RequireVerifiedEmail == config.VerifyNone {
+		return c.Next()
+	}
+
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+
+	var user models.User
+	if err := helpers.DB().Select("id", "email_verified").Where("id = ?", principal.UserID).First(&user).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "unauthenticated"})
+	}
+	if !user.EmailVerified {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "email not verified"})
+	}
+	return c.Next()
+}
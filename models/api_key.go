@@ -0,0 +1,42 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// APIKey is a long-lived credential for scripts and machine clients, sent as the X-API-Key header.
+// The key itself is shown once at creation; we keep its SHA-256 and its Prefix, the
+// non-secret start of the key that lets people tell their keys apart ("fapi_1a2b3c4d").
+type APIKey struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID      uuid.UUID `gorm:"type:uuid;index"`
+	User        User      `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Name        string    `gorm:"not null"`
+	Prefix      string    `gorm:"not null;uniqueIndex"`
+	KeyHash     string    `gorm:"not null"`
+	Scopes      string    `gorm:"not null"` // space separated, like an OAuth scope string
+	CreatedByID uuid.UUID `gorm:"type:uuid"`
+	ExpiresAt   *time.Time
+	LastUsedAt  *time.Time
+	RevokedAt   *time.Time
+	CreatedAt   time.Time
+}
+
+func (key *APIKey) BeforeCreate(tx *gorm.DB) (err error) {
+	key.ID = uuid.New()
+	return
+}
+
+// ScopeList splits Scopes into its entries.
+func (key APIKey) ScopeList() []string {
+	return strings.Fields(key.Scopes)
+}
+
+// Active reports whether the key can still be used.
+func (key APIKey) Active(now time.Time) bool {
+	return key.RevokedAt == nil && (key.ExpiresAt == nil || key.ExpiresAt.After(now))
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EmailVerificationToken is the single-use link in the "confirm your email" message.
+// Only its SHA-256 is stored, like PasswordResetToken.
+type EmailVerificationToken struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID  `gorm:"type:uuid;index"`
+	User      User       `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	TokenHash string     `gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // set when the email was confirmed (or a newer token replaced this one)
+	CreatedAt time.Time
+}
+
+func (token *EmailVerificationToken) BeforeCreate(tx *gorm.DB) (err error) {
+	token.ID = uuid.New()
+	return
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ExternalIdentity links an account at an OpenID Connect provider to a user. The provider's
+// stable id is Issuer + Subject; the email is only what it was at linking time, since people
+// can change it at the provider.
+type ExternalIdentity struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID      uuid.UUID `gorm:"type:uuid;index"`
+	User        User      `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Issuer      string    `gorm:"not null;uniqueIndex:idx_external_identity_subject"`
+	Subject     string    `gorm:"not null;uniqueIndex:idx_external_identity_subject"`
+	Email       string
+	LastLoginAt time.Time
+	CreatedAt   time.Time
+}
+
+func (identity *ExternalIdentity) BeforeCreate(tx *gorm.DB) (err error) {
+	identity.ID = uuid.New()
+	return
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// LoginThrottle counts recent failed logins for one key: an account ("email:jane@example.com")
+// or a client address ("ip:203.0.113.7"). Keys for emails without an account are tracked the
+// same way, so throttling does not reveal which emails are registered.
+type LoginThrottle struct {
+	Key           string `gorm:"primaryKey"`
+	Failures      int    `gorm:"not null;default:0"`
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MagicLinkToken records an emailed login link. The link itself is a signed JWT; this row makes
+// it single-use (by its jti) and ties it to the browser that asked for it: only the SHA-256 of
+// the nonce in that browser's cookie is stored.
+type MagicLinkToken struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID  `gorm:"type:uuid;index"`
+	User      User       `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	TokenID   string     `gorm:"not null;uniqueIndex"` // jti of the link's JWT
+	NonceHash string     `gorm:"not null"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // set when the link was used (or replaced by a newer one)
+	CreatedAt time.Time  `gorm:"index"`
+}
+
+func (token *MagicLinkToken) BeforeCreate(tx *gorm.DB) (err error) {
+	token.ID = uuid.New()
+	return
+}
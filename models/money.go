@@ -0,0 +1,204 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is used when old rows that only stored a number are converted to Money.
+const DefaultCurrency = "USD"
+
+var (
+	ErrCurrencyMismatch = errors.New("currencies do not match")
+	ErrAmountOverflow   = errors.New("amount is too large")
+)
+
+// minorUnitDigits lists the currencies that do not use 2 decimal places.
+var minorUnitDigits = map[string]int{
+	"JPY": 0, "KRW": 0, "VND": 0, "CLP": 0, "ISK": 0,
+	"BHD": 3, "KWD": 3, "OMR": 3, "JOD": 3, "TND": 3,
+}
+
+// Money is an exact amount in the smallest unit of a currency (cents for USD), so 19.99 USD is {1999, "USD"}.
+// Never use float64 for money: 0.1 + 0.2 is not 0.3 in floating point.
+//
+// In the database it is one text column holding "<amount> <currency>", e.g. "1999 USD".
+// The amount comes first on purpose: SQLite's CAST(price AS INTEGER) reads the leading number,
+// so we can still ORDER BY or SUM prices in SQL.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func NewMoney(amount int64, currency string) (Money, error) {
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// ParseMoney reads a decimal string like "19.99" into minor units.
+// It refuses values with more decimal places than the currency has, instead of rounding them away.
+func ParseMoney(value string, currency string) (Money, error) {
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	amount, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount %q", value)
+	}
+
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digitsFor(currency))), nil))
+	amount.Mul(amount, scale)
+	if !amount.IsInt() || !amount.Num().IsInt64() {
+		return Money{}, fmt.Errorf("amount %q cannot be represented in %s", value, currency)
+	}
+
+	return Money{Amount: amount.Num().Int64(), Currency: currency}, nil
+}
+
+// Add returns m + other. Adding two different currencies is an error, never a silent conversion.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency == "" {
+		return other, nil
+	}
+	if other.Currency != m.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	sum := m.Amount + other.Amount
+	// Signed overflow wraps around: the sum then has the wrong sign for its operands.
+	if (other.Amount > 0 && sum < m.Amount) || (other.Amount < 0 && sum > m.Amount) {
+		return Money{}, ErrAmountOverflow
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Mul returns the money multiplied by a whole number, e.g. unit price * quantity.
+// A product that does not fit in int64 is ErrAmountOverflow, never a wrapped-around amount.
+func (m Money) Mul(quantity int64) (Money, error) {
+	product := m.Amount * quantity
+	if m.Amount != 0 && (product/m.Amount != quantity || (m.Amount == -1 && quantity == math.MinInt64)) {
+		return Money{}, ErrAmountOverflow
+	}
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// Decimal formats the amount in major units, e.g. 1999 USD -> "19.99".
+func (m Money) Decimal() string {
+	digits := digitsFor(m.Currency)
+	if digits == 0 {
+		return strconv.FormatInt(m.Amount, 10)
+	}
+	return new(big.Rat).SetFrac64(m.Amount, pow10(digits)).FloatString(digits)
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// MarshalJSON adds a ready-to-display "formatted" value next to the exact amount.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount    int64  `json:"amount"`
+		Currency  string `json:"currency"`
+		Formatted string `json:"formatted"`
+	}{m.Amount, m.Currency, m.Decimal()})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	money, err := NewMoney(raw.Amount, raw.Currency)
+	if err != nil {
+		return err
+	}
+	*m = money
+	return nil
+}
+
+// GormDataType keeps the column as text. Without it GORM would guess INTEGER from the Amount field.
+func (Money) GormDataType() string {
+	return "string"
+}
+
+// Value stores the money as "<amount> <currency>".
+func (m Money) Value() (driver.Value, error) {
+	if m.Currency == "" {
+		return nil, nil
+	}
+	return strconv.FormatInt(m.Amount, 10) + " " + m.Currency, nil
+}
+
+func (m *Money) Scan(value interface{}) error {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		*m = Money{}
+		return nil
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", value)
+	}
+
+	amountText, currency, found := strings.Cut(text, " ")
+	if !found {
+		return fmt.Errorf("invalid money value %q", text)
+	}
+	amount, err := strconv.ParseInt(amountText, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid money value %q", text)
+	}
+
+	money, err := NewMoney(amount, currency)
+	if err != nil {
+		return err
+	}
+	*m = money
+	return nil
+}
+
+func normalizeCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if len(currency) != 3 {
+		return "", fmt.Errorf("invalid currency code %q", currency)
+	}
+	for _, r := range currency {
+		if r < 'A' || r > 'Z' {
+			return "", fmt.Errorf("invalid currency code %q", currency)
+		}
+	}
+	return currency, nil
+}
+
+func digitsFor(currency string) int {
+	if digits, ok := minorUnitDigits[currency]; ok {
+		return digits
+	}
+	return 2
+}
+
+func pow10(n int) int64 {
+	result := int64(1)
+	for i := 0; i < n; i++ {
+		result *= 10
+	}
+	return result
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// OIDCLoginState remembers one "sign in with the identity provider" attempt between sending the
+// browser away and the provider sending it back. StateHash is the SHA-256 of the state parameter
+// (also kept in a cookie of the browser that started), and each row is deleted when used.
+type OIDCLoginState struct {
+	StateHash    string    `gorm:"primaryKey"`
+	Nonce        string    `gorm:"not null"` // must come back inside the ID token
+	CodeVerifier string    `gorm:"not null"` // PKCE secret sent with the code exchange
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	CreatedAt    time.Time
+}
+
+// TableName keeps GORM from splitting "OIDC" into "o_id_c".
+func (OIDCLoginState) TableName() string {
+	return "oidc_login_states"
+}
@@ -10,8 +10,6 @@ import (
 type Order struct {
 	ID        uuid.UUID `json:"id" gorm:"primaryKey;type:string"`
 	CreatedAt time.Time
-	ProductId uuid.UUID `json:"product_id"`
-	Product   Product   `gorm:"foreignKey:ProductId"`
 	// UserId    uuid.UUID `json:"user_id"`
 	// User      User      `gorm:"foreignKey:UserId"`
 	// 1. Index: Makes searching orders by user FAST.
@@ -19,6 +17,15 @@ type Order struct {
 
 	// 2. Constraint: If User is deleted, DELETE this Order automatically.
 	User User `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+
+	// Total is computed on the server from the items, never taken from the client.
+	Total Money       `json:"total"`
+	Items []OrderItem `json:"items" gorm:"foreignKey:OrderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+
+	// Status only changes through repositories.TransitionOrder, which checks the transition table
+	// and writes a StatusHistory row for every move.
+	Status        OrderStatus         `json:"status" gorm:"not null;default:pending;index"`
+	StatusHistory []OrderStatusChange `json:"status_history" gorm:"foreignKey:OrderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 }
 
 func (order *Order) BeforeCreate(tx *gorm.DB) (err error) {
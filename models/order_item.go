@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OrderItem is one line of an order.
+// ProductName and UnitPrice are copied from the product when the order is placed,
+// so later catalog changes do not rewrite order history.
+type OrderItem struct {
+	ID          uuid.UUID `json:"id" gorm:"primaryKey;type:string"`
+	CreatedAt   time.Time
+	OrderID     uuid.UUID `json:"order_id" gorm:"type:uuid;index"`
+	ProductID   uuid.UUID `json:"product_id" gorm:"type:uuid;index"`
+	Product     Product   `gorm:"foreignKey:ProductID"`
+	ProductName string    `json:"product_name"`
+	Quantity    int       `json:"quantity"`
+	UnitPrice   Money     `json:"unit_price"`
+}
+
+func (item *OrderItem) BeforeCreate(tx *gorm.DB) (err error) {
+	item.ID = uuid.New()
+	return
+}
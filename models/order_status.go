@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type OrderStatus string
+
+const (
+	OrderPending   OrderStatus = "pending"
+	OrderPaid      OrderStatus = "paid"
+	OrderFulfilled OrderStatus = "fulfilled"
+	OrderShipped   OrderStatus = "shipped"
+	OrderDelivered OrderStatus = "delivered"
+	OrderCancelled OrderStatus = "cancelled"
+	OrderRefunded  OrderStatus = "refunded"
+)
+
+// orderTransitions is the whole order lifecycle: for each status, the statuses it may move to.
+// Anything not listed here (e.g. shipped -> pending) is rejected.
+// cancelled and refunded are final, so they have no outgoing moves.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderPending:   {OrderPaid, OrderCancelled},
+	OrderPaid:      {OrderFulfilled, OrderCancelled, OrderRefunded},
+	OrderFulfilled: {OrderShipped, OrderRefunded},
+	OrderShipped:   {OrderDelivered},
+	OrderDelivered: {OrderRefunded},
+	OrderCancelled: {},
+	OrderRefunded:  {},
+}
+
+func (status OrderStatus) Valid() bool {
+	_, ok := orderTransitions[status]
+	return ok
+}
+
+// CanTransitionTo reports whether an order in this status may move to next.
+func (status OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[status] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderStatusChange is one row of an order's history: who moved it, from what, to what, and when.
+// The first row of every order has an empty FromStatus (the order was created).
+type OrderStatusChange struct {
+	ID          uuid.UUID   `json:"id" gorm:"primaryKey;type:string"`
+	OrderID     uuid.UUID   `json:"order_id" gorm:"type:uuid;index"`
+	FromStatus  OrderStatus `json:"from_status"`
+	ToStatus    OrderStatus `json:"to_status" gorm:"not null"`
+	ChangedByID uuid.UUID   `json:"changed_by_id" gorm:"type:uuid"`
+	CreatedAt   time.Time
+}
+
+func (change *OrderStatusChange) BeforeCreate(tx *gorm.DB) (err error) {
+	change.ID = uuid.New()
+	return
+}
@@ -12,8 +12,9 @@ type Product struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Name      string `json:"name"`
-	Price     string `json:"price"`
-	Quantity  string `json:"quantity"`
+	Price     Money  `json:"price"`
+	// Stock is how many units we can still sell.
+	Stock int `json:"stock" gorm:"not null;default:0"`
 }
 
 func (product *Product) BeforeCreate(tx *gorm.DB) (err error) {
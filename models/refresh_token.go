@@ -15,10 +15,48 @@ type RefreshToken struct {
 	IsRevoked bool      `gorm:"default:false"`
 	ExpiresAt time.Time `gorm:"not null"`
 	CreatedAt time.Time
+
+	// FamilyID groups every token rotated from the same login (one browser/device session).
+	// The first token of a login starts a family; each rotation adds a child with ParentID
+	// pointing at the token it replaced. Reuse of a rotated token revokes only its own family.
+	FamilyID uuid.UUID  `gorm:"type:uuid;index"`
+	ParentID *uuid.UUID `gorm:"type:uuid"`
+	// RotatedAt is set when the token was exchanged for a new one, as opposed to revoked by logout.
+	RotatedAt *time.Time
+	// The client that received this token, used to tell a racing double-refresh from theft.
+	IPAddress string
+	UserAgent string
+	// The access token issued together with this refresh token, denylisted when the session is revoked.
+	AccessTokenID        string `gorm:"index"`
+	AccessTokenExpiresAt *time.Time
+	// ClientID is the OAuth client the token was issued to by /oauth/token ("" for a login),
+	// and Scope the space-separated scopes it was granted. Both carry over on rotation.
+	ClientID string `gorm:"index"`
+	Scope    string
+}
+
+// TokenReuseEvent records a rotated refresh token being presented again.
+// This usually means the token was stolen, so the whole family is revoked when it happens.
+type TokenReuseEvent struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;index"`
+	FamilyID  uuid.UUID `gorm:"type:uuid;index"`
+	TokenID   uuid.UUID `gorm:"type:uuid"`
+	IPAddress string
+	UserAgent string
+	CreatedAt time.Time
+}
+
+func (event *TokenReuseEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	event.ID = uuid.New()
+	return
 }
 
 func (token *RefreshToken) BeforeCreate(tx *gorm.DB) (err error) {
 	token.ID = uuid.New()
+	if token.FamilyID == uuid.Nil {
+		token.FamilyID = uuid.New()
+	}
 	return
 }
 
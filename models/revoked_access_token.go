@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RevokedAccessToken is a denylisted access token, identified by its "jti" claim.
+// Access tokens are not stored anywhere, so this is the only way to kill one before it expires.
+// The row is useless after ExpiresAt (the token fails validation anyway) and is purged then.
+type RevokedAccessToken struct {
+	JTI       string    `gorm:"primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;index"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TOTPCredential is a user's authenticator app. It only counts once ConfirmedAt is set,
+// i.e. after the user proved the app produces valid codes.
+//
+// The secret has to be stored as-is, because the server computes the same codes as the app.
+type TOTPCredential struct {
+	UserID      uuid.UUID `gorm:"type:uuid;primaryKey"`
+	User        User      `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Secret      string    `gorm:"not null"`
+	ConfirmedAt *time.Time
+	// LastUsedStep is the time step of the last accepted code, so the same code cannot be used twice.
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+// RecoveryCode is a one-time code that replaces a TOTP code when the phone is lost.
+// Only its SHA-256 is stored.
+type RecoveryCode struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;index"`
+	User      User      `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CodeHash  string    `gorm:"not null;index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (code *RecoveryCode) BeforeCreate(tx *gorm.DB) (err error) {
+	code.ID = uuid.New()
+	return
+}
@@ -7,17 +7,38 @@ import (
 	"gorm.io/gorm"
 )
 
+type Role string
+
+const (
+	RoleAdmin    Role = "admin"
+	RoleCustomer Role = "customer"
+)
+
 type User struct {
 	ID        uuid.UUID `json:"id" gorm:"primaryKey;type:string"`
 	FirstName string    `json:"firstName"`
 	LastName  string    `json:"lastName"`
 	Email     string    `json:"email" gorm:"unique"`
 	Password  []byte    `json:"-"`
+	// Every new account is a customer. Admins are promoted by another admin (PATCH /api/users/:id)
+	// or, for the very first one, directly in the database.
+	Role      Role `json:"role" gorm:"not null;default:customer"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	// EmailVerified is set once the user opened the link from the verification email.
+	EmailVerified   bool `json:"emailVerified" gorm:"not null;default:false"`
+	EmailVerifiedAt *time.Time
+
+	// ServiceAccount marks a machine user: it has no password, cannot log in, and only
+	// authenticates with API keys an admin creates for it.
+	ServiceAccount bool `json:"serviceAccount" gorm:"not null;default:false"`
 }
 
 func (user *User) BeforeCreate(tx *gorm.DB) (err error) {
 	user.ID = uuid.New()
+	if user.Role == "" {
+		user.Role = RoleCustomer
+	}
 	return
 }
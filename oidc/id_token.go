@@ -0,0 +1,208 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keyRefetchInterval limits how often an unknown "kid" makes us fetch the provider's JWKS again,
+// so tokens with made-up key ids cannot turn us into a request amplifier against the provider.
+const keyRefetchInterval = time.Minute
+
+// clockSkew is how far the provider's clock may be off from ours.
+const clockSkew = time.Minute
+
+// IDTokenClaims are the ID token claims we use (OpenID Connect Core 1.0, sections 2 and 5.1).
+type IDTokenClaims struct {
+	Nonce           string    `json:"nonce"`
+	AuthorizedParty string    `json:"azp,omitempty"`
+	Email           string    `json:"email"`
+	EmailVerified   boolClaim `json:"email_verified"`
+	Name            string    `json:"name"`
+	GivenName       string    `json:"given_name"`
+	FamilyName      string    `json:"family_name"`
+	jwt.RegisteredClaims
+}
+
+// boolClaim reads a JSON boolean, and also the string "true"/"false" some providers send instead.
+type boolClaim bool
+
+func (b *boolClaim) UnmarshalJSON(data []byte) error {
+	var value bool
+	if err := json.Unmarshal(data, &value); err == nil {
+		*b = boolClaim(value)
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	value, err := strconv.ParseBool(text)
+	if err != nil {
+		return fmt.Errorf("email_verified: %w", err)
+	}
+	*b = boolClaim(value)
+	return nil
+}
+
+// VerifyIDToken checks the ID token from Exchange: signature against the provider's published keys,
+// issuer, audience (and azp when there are several audiences), expiry, and that its nonce is the
+// one we put in the authorization request, which ties the token to this login attempt.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken string, nonce string) (*IDTokenClaims, error) {
+	if _, err := p.Discover(ctx); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	keys := p.keys
+	p.mu.Unlock()
+
+	claims := &IDTokenClaims{}
+	token, err := jwt.ParseWithClaims(rawIDToken, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			key, err := keys.lookup(ctx, p, kid)
+			if err != nil {
+				return nil, err
+			}
+			// The key decides the algorithm, not the token, so an attacker cannot pick a weaker one.
+			if token.Method.Alg() != key.method.Alg() {
+				return nil, fmt.Errorf("unexpected signing method %q for key %q", token.Method.Alg(), kid)
+			}
+			return key.public, nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+		jwt.WithTimeFunc(p.Now),
+	)
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientID {
+		return nil, errors.New("invalid id token: azp does not name this client")
+	}
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, errors.New("invalid id token: nonce does not match")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid id token: missing sub")
+	}
+	return claims, nil
+}
+
+type publicKey struct {
+	public interface{}
+	method jwt.SigningMethod
+}
+
+// keyCache holds the provider's signing keys from its jwks_uri.
+type keyCache struct {
+	uri string
+
+	mu        sync.Mutex
+	keys      map[string]publicKey
+	fetchedAt time.Time
+}
+
+// lookup returns the key named kid. An unknown kid usually means the provider rotated its keys,
+// so the set is fetched again, at most once per keyRefetchInterval.
+func (cache *keyCache) lookup(ctx context.Context, p *Provider, kid string) (publicKey, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if key, ok := cache.find(kid); ok {
+		return key, nil
+	}
+	if !cache.fetchedAt.IsZero() && time.Since(cache.fetchedAt) < keyRefetchInterval {
+		return publicKey{}, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set helpers.JWKSet
+	if err := p.getJSON(ctx, cache.uri, &set); err != nil {
+		return publicKey{}, fmt.Errorf("oidc jwks: %w", err)
+	}
+	keys := map[string]publicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := parseJWK(jwk)
+		if err != nil {
+			continue // keys of a type we do not support are simply never used
+		}
+		keys[jwk.Kid] = key
+	}
+	cache.keys = keys
+	cache.fetchedAt = time.Now()
+
+	if key, ok := cache.find(kid); ok {
+		return key, nil
+	}
+	return publicKey{}, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// find returns the key named kid. A token without "kid" is only accepted while the
+// provider publishes a single key, where there is nothing to choose.
+func (cache *keyCache) find(kid string) (publicKey, bool) {
+	if kid == "" && len(cache.keys) == 1 {
+		for _, key := range cache.keys {
+			return key, true
+		}
+	}
+	key, ok := cache.keys[kid]
+	return key, ok && kid != ""
+}
+
+// parseJWK turns an RSA or Ed25519 JWK into a public key, the same two kinds we sign with ourselves.
+func parseJWK(jwk helpers.JWK) (publicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return publicKey{}, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return publicKey{}, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return publicKey{}, errors.New("invalid RSA exponent")
+		}
+		public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+		if public.N.BitLen() < 2048 {
+			return publicKey{}, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return publicKey{public: public, method: jwt.SigningMethodRS256}, nil
+	case "OKP":
+		x, err := decode(jwk.X)
+		if err != nil {
+			return publicKey{}, err
+		}
+		if jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return publicKey{}, errors.New("unsupported OKP key")
+		}
+		return publicKey{public: ed25519.PublicKey(x), method: jwt.SigningMethodEdDSA}, nil
+	default:
+		return publicKey{}, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
@@ -0,0 +1,201 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amanguptak/fiber-api/config"
+)
+
+// metadataTTL is how long the discovery document is cached before it is fetched again.
+const metadataTTL = time.Hour
+
+// Metadata is the part of the provider's discovery document (/.well-known/openid-configuration)
+// that the authorization code flow needs.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is one external OpenID Connect identity provider we let users sign in with.
+// Everything it learns about the provider comes over HTTP from Issuer, so pointing Issuer at an
+// in-process fake (see package oidctest) exercises the same code as a real provider.
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for a public client, which only proves itself with PKCE
+	RedirectURL  string
+	Scopes       []string
+
+	// Client makes every request to the provider. Tests can swap it for one that trusts a test TLS certificate.
+	Client *http.Client
+	// Now is the clock ID tokens are checked against.
+	Now func() time.Time
+
+	mu         sync.Mutex
+	metadata   *Metadata
+	metadataAt time.Time
+	keys       *keyCache
+}
+
+// Default is the provider configured by OIDC_ISSUER, or nil when social login is off.
+var Default *Provider
+
+// Setup builds Default from the config. Nothing is fetched yet, so the server starts even
+// while the provider is unreachable; discovery happens on the first login.
+func Setup(cfg config.Config) {
+	if cfg.OIDCIssuer == "" {
+		Default = nil
+		return
+	}
+	Default = NewProvider(cfg.OIDCIssuer, cfg.OIDCClientID, cfg.OIDCClientSecret, cfg.OIDCRedirectURL, cfg.OIDCScopes)
+}
+
+func NewProvider(issuer string, clientID string, clientSecret string, redirectURL string, scopes []string) *Provider {
+	return &Provider{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+		Now:          time.Now,
+	}
+}
+
+// Discover returns the provider's metadata, fetching it when the cached copy is missing or old.
+func (p *Provider) Discover(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil && time.Since(p.metadataAt) < metadataTTL {
+		return p.metadata, nil
+	}
+
+	var metadata Metadata
+	if err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &metadata); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	// OpenID Connect Discovery 1.0, section 4.3: the document must name exactly the issuer we asked,
+	// or a compromised or misconfigured document could point us at someone else's tokens.
+	if strings.TrimSuffix(metadata.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", metadata.Issuer, p.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: document is missing an endpoint")
+	}
+
+	p.metadata = &metadata
+	p.metadataAt = time.Now()
+	if p.keys == nil || p.keys.uri != metadata.JWKSURI {
+		p.keys = &keyCache{uri: metadata.JWKSURI}
+	}
+	return p.metadata, nil
+}
+
+// AuthCodeURL is where the browser is sent to sign in. state, nonce and the PKCE challenge
+// come back to us through the callback, the ID token and the token exchange respectively.
+func (p *Provider) AuthCodeURL(ctx context.Context, state string, nonce string, codeChallenge string) (string, error) {
+	metadata, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", p.RedirectURL)
+	query.Set("scope", strings.Join(p.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return metadata.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// tokenResponse is the token endpoint's answer (RFC 6749 section 5.1 and 5.2).
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	TokenType        string `json:"token_type"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange trades the authorization code for the provider's tokens and returns the raw ID token.
+// The verifier proves we are the client that started the flow (PKCE, RFC 7636).
+func (p *Provider) Exchange(ctx context.Context, code string, verifier string) (string, error) {
+	metadata, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.ClientID)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		// client_secret_basic, the method every provider must support.
+		request.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	response, err := p.Client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("oidc token exchange: %w", err)
+	}
+	defer response.Body.Close()
+
+	var tokens tokenResponse
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&tokens); err != nil {
+		return "", fmt.Errorf("oidc token exchange: %s: %w", response.Status, err)
+	}
+	if response.StatusCode != http.StatusOK || tokens.Error != "" {
+		return "", fmt.Errorf("oidc token exchange: %s: %s %s", response.Status, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("oidc token exchange: no id_token in the response")
+	}
+	return tokens.IDToken, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, target any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	response, err := p.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, response.Status)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(target)
+}
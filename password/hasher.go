@@ -0,0 +1,123 @@
+package password
+
+import (
+	"errors"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// Hasher turns passwords into self-describing encoded hashes: the algorithm and its parameters
+// are stored in the string ("$argon2id$v=19$m=19456,t=2,p=1$salt$hash", "$2a$12$..."),
+// so old hashes keep verifying after the defaults change.
+type Hasher interface {
+	// Hash returns the encoded hash of password with a fresh random salt.
+	Hash(password string) (string, error)
+	// Verify reports whether password matches an encoded hash made by this algorithm.
+	Verify(password string, encoded string) (bool, error)
+	// NeedsRehash reports whether encoded was made with other parameters than this hasher uses now.
+	NeedsRehash(encoded string) bool
+	// Handles reports whether encoded was made by this algorithm.
+	Handles(encoded string) bool
+	// WithParamsOf returns a hasher of this algorithm that uses the parameters encoded was made with.
+	WithParamsOf(encoded string) (Hasher, error)
+}
+
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// Default hashes new passwords. Set by Setup in main; Argon2id unless PASSWORD_HASHER says bcrypt.
+var Default Hasher = NewArgon2id()
+
+// known lists every algorithm we can still verify, so hashes from before a switch keep working.
+var known = []Hasher{NewArgon2id(), NewBcrypt()}
+
+// Hash hashes password with the Default hasher.
+func Hash(password string) ([]byte, error) {
+	encoded, err := Default.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(encoded), nil
+}
+
+// Recognized reports whether encoded is a hash of a known algorithm, so Verify can check it.
+// An empty one (an account without a password) is not.
+func Recognized(encoded []byte) bool {
+	hash := string(encoded)
+	return Default.Handles(hash) || slices.ContainsFunc(known, func(h Hasher) bool { return h.Handles(hash) })
+}
+
+// Verify checks password against an encoded hash made by any known algorithm.
+// rehash is true when the password matched but the hash should be replaced by Hash(password),
+// because it was made with another algorithm or older parameters than Default.
+func Verify(password string, encoded []byte) (ok bool, rehash bool, err error) {
+	hash := string(encoded)
+
+	if Default.Handles(hash) {
+		ok, err = Default.Verify(password, hash)
+		return ok, ok && Default.NeedsRehash(hash), err
+	}
+	for _, hasher := range known {
+		if hasher.Handles(hash) {
+			ok, err = hasher.Verify(password, hash)
+			return ok, ok, err
+		}
+	}
+	return false, false, ErrUnknownHash
+}
+
+// dummyHash is what DummyHash returns; nil until it is first needed or UseStoredHashes runs.
+var dummyHash atomic.Pointer[[]byte]
+
+func dummyFor(hasher Hasher) []byte {
+	hash, _ := hasher.Hash("dummy password for timing")
+	return []byte(hash)
+}
+
+// DummyHash is something to Verify against when there is no user, so a login with an unknown
+// email takes as long as one with a wrong password. It is made like the slowest of the stored
+// hashes (see UseStoredHashes), by Default until told otherwise.
+func DummyHash() []byte {
+	if hash := dummyHash.Load(); hash != nil {
+		return *hash
+	}
+	hash := dummyFor(Default)
+	dummyHash.CompareAndSwap(nil, &hash)
+	return *dummyHash.Load()
+}
+
+// UseStoredHashes makes the dummy hash like the slowest of samples, stored password hashes with
+// one sample per algorithm and parameters ("$2a$12$", "$2a$14$", "$argon2id$v=19$m=19456,t=2,p=1$").
+// Hashes keep their algorithm and cost until the account next logs in, e.g. bcrypt after
+// switching to Argon2id, or an old higher cost; an unknown email must cost as much as those,
+// or the quick answer gives it away. Accounts with a faster hash still answer faster until
+// then; that difference is gone once they are all upgraded. Default always counts, since new
+// hashes use it.
+func UseStoredHashes(samples [][]byte) {
+	hashers := []Hasher{Default}
+	for _, sample := range samples {
+		hash := string(sample)
+		for _, hasher := range known {
+			if !hasher.Handles(hash) {
+				continue
+			}
+			if like, err := hasher.WithParamsOf(hash); err == nil && !slices.Contains(hashers, like) {
+				hashers = append(hashers, like)
+			}
+			break
+		}
+	}
+
+	// Time one wrong guess per hasher: costs of different algorithms do not compare otherwise.
+	var slowest []byte
+	var slowestTime time.Duration
+	for _, hasher := range hashers {
+		hash := dummyFor(hasher)
+		started := time.Now()
+		hasher.Verify("not the dummy password", string(hash))
+		if elapsed := time.Since(started); slowest == nil || elapsed > slowestTime {
+			slowest, slowestTime = hash, elapsed
+		}
+	}
+	dummyHash.Store(&slowest)
+}
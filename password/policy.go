@@ -0,0 +1,149 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/amanguptak/fiber-api/config"
+)
+
+// Policy decides which new passwords are acceptable. It follows NIST SP 800-63B: a minimum
+// length and a check against known-breached passwords, but no "one digit, one symbol" rules,
+// which only push people towards "Password1!".
+type Policy struct {
+	MinLength int // in characters
+	MaxLength int // in characters; bcrypt also stops at 72 bytes
+	breached  map[string]struct{}
+}
+
+var (
+	ErrPasswordTooShort = errors.New("password is too short")
+	ErrPasswordTooLong  = errors.New("password is too long")
+	ErrPasswordBreached = errors.New("password appears in a list of breached passwords, choose another one")
+	ErrPasswordPersonal = errors.New("password must not be your email address")
+)
+
+//go:embed breached.txt
+var builtinBreached string
+
+// DefaultPolicy is the policy Register and ResetPassword apply. Set by Setup in main.
+var DefaultPolicy = Policy{MinLength: 8, MaxLength: 128, breached: mustLoadBreached(strings.NewReader(builtinBreached))}
+
+// Validate checks a new password. personal are values the password must not be, such as the
+// user's email address; they are compared ignoring case.
+func (p Policy) Validate(password string, personal ...string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return fmt.Errorf("%w: use at least %d characters", ErrPasswordTooShort, p.MinLength)
+	}
+	if length > p.MaxLength {
+		return fmt.Errorf("%w: use at most %d characters", ErrPasswordTooLong, p.MaxLength)
+	}
+	if _, isBcrypt := Default.(Bcrypt); isBcrypt && len(password) > 72 {
+		// bcrypt ignores everything after 72 bytes, so longer passwords would be silently shortened.
+		return fmt.Errorf("%w: use at most 72 bytes", ErrPasswordTooLong)
+	}
+
+	for _, value := range personal {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if strings.EqualFold(password, value) {
+			return ErrPasswordPersonal
+		}
+		if local, _, found := strings.Cut(value, "@"); found && strings.EqualFold(password, local) {
+			return ErrPasswordPersonal
+		}
+	}
+
+	if p.isBreached(password) || p.isBreached(strings.ToLower(password)) {
+		return ErrPasswordBreached
+	}
+	return nil
+}
+
+func (p Policy) isBreached(password string) bool {
+	_, found := p.breached[sha1Hex(password)]
+	return found
+}
+
+// Validate checks password against DefaultPolicy.
+func Validate(password string, personal ...string) error {
+	return DefaultPolicy.Validate(password, personal...)
+}
+
+// Setup configures the Default hasher and DefaultPolicy. The built-in breached list is always
+// included; cfg.BreachedPasswordsFile adds a bigger one.
+func Setup(cfg config.Config) error {
+	switch cfg.PasswordHasher {
+	case config.HasherArgon2id:
+		Default = NewArgon2id()
+	case config.HasherBcrypt:
+		Default = NewBcrypt()
+	default:
+		return fmt.Errorf("unknown password hasher %q", cfg.PasswordHasher)
+	}
+
+	breached := mustLoadBreached(strings.NewReader(builtinBreached))
+	if cfg.BreachedPasswordsFile != "" {
+		file, err := os.Open(cfg.BreachedPasswordsFile)
+		if err != nil {
+			return fmt.Errorf("breached passwords file: %w", err)
+		}
+		defer file.Close()
+		if err := loadBreached(file, breached); err != nil {
+			return fmt.Errorf("breached passwords file %s: %w", cfg.BreachedPasswordsFile, err)
+		}
+	}
+
+	DefaultPolicy = Policy{MinLength: cfg.PasswordMinLength, MaxLength: cfg.PasswordMaxLength, breached: breached}
+
+	// Compute the dummy hash with the new hasher now, not during the first unknown-email login.
+	// main refines it with repositories.RefreshDummyPasswordHash once the database is open.
+	UseStoredHashes(nil)
+	return nil
+}
+
+// loadBreached reads one password per line into set, keyed by upper-case SHA-1. A line that
+// already is a SHA-1 (40 hex characters, optionally followed by ":count") is used as-is.
+func loadBreached(r io.Reader, set map[string]struct{}) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(line, ":")
+		if len(hash) == 40 {
+			if _, err := hex.DecodeString(hash); err == nil {
+				set[strings.ToUpper(hash)] = struct{}{}
+				continue
+			}
+		}
+		set[sha1Hex(line)] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+func mustLoadBreached(r io.Reader) map[string]struct{} {
+	set := map[string]struct{}{}
+	if err := loadBreached(r, set); err != nil {
+		panic(err)
+	}
+	return set
+}
+
+func sha1Hex(value string) string {
+	sum := sha1.Sum([]byte(value))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
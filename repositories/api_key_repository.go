@@ -0,0 +1,139 @@
+package repositories
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key does not exist")
+	ErrAPIKeyInvalid  = errors.New("api key is invalid, expired or revoked")
+)
+
+// apiKeyPrefix starts every key, so leaked keys are easy to spot (e.g. by secret scanners).
+const apiKeyPrefix = "fapi_"
+
+// apiKeyTouchInterval limits how often LastUsedAt is written: once a minute is precise enough
+// to see which keys are in use, and saves a write on every request.
+const apiKeyTouchInterval = time.Minute
+
+// CreateAPIKey creates a key for userID and returns it in clear text; only its hash is stored,
+// so this is the only time anyone sees it. The key looks like "fapi_<8 hex>_<64 hex>", where
+// the first part is the public Prefix used to find it again.
+func CreateAPIKey(userID uuid.UUID, createdByID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (string, models.APIKey, error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", models.APIKey{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", models.APIKey{}, err
+	}
+
+	prefix := apiKeyPrefix + hex.EncodeToString(id)
+	key := prefix + "_" + hex.EncodeToString(secret)
+
+	apiKey := models.APIKey{
+		UserID:      userID,
+		Name:        name,
+		Prefix:      prefix,
+		KeyHash:     HashToken(key),
+		Scopes:      strings.Join(scopes, " "),
+		CreatedByID: createdByID,
+		ExpiresAt:   expiresAt,
+	}
+	if err := helpers.DB().Create(&apiKey).Error; err != nil {
+		return "", models.APIKey{}, err
+	}
+	return key, apiKey, nil
+}
+
+// ListAPIKeys returns all keys of a user, revoked ones included, newest first.
+func ListAPIKeys(userID uuid.UUID) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := helpers.DB().Where("user_id = ?", userID).Order("created_at desc").Find(&keys).Error
+	return keys, err
+}
+
+// RevokeAPIKey stops a key of userID from working. The row stays for the audit trail.
+func RevokeAPIKey(userID uuid.UUID, keyID uuid.UUID) error {
+	result := helpers.DB().Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// ResolveAPIKey checks a key from an X-API-Key header and returns it with its owner.
+// The owner is loaded fresh, so a role change or deleted user takes effect immediately.
+func ResolveAPIKey(key string) (models.APIKey, models.User, error) {
+	prefix, _, found := strings.Cut(strings.TrimPrefix(key, apiKeyPrefix), "_")
+	if !strings.HasPrefix(key, apiKeyPrefix) || !found {
+		return models.APIKey{}, models.User{}, ErrAPIKeyInvalid
+	}
+
+	var apiKey models.APIKey
+	if err := helpers.DB().Where("prefix = ?", apiKeyPrefix+prefix).First(&apiKey).Error; err != nil {
+		return models.APIKey{}, models.User{}, ErrAPIKeyInvalid
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(HashToken(key))) != 1 {
+		return models.APIKey{}, models.User{}, ErrAPIKeyInvalid
+	}
+
+	now := time.Now()
+	if !apiKey.Active(now) {
+		return models.APIKey{}, models.User{}, ErrAPIKeyInvalid
+	}
+
+	var user models.User
+	if err := helpers.DB().Where("id = ?", apiKey.UserID).First(&user).Error; err != nil {
+		return models.APIKey{}, models.User{}, ErrAPIKeyInvalid
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyTouchInterval {
+		helpers.DB().Model(&models.APIKey{}).Where("id = ?", apiKey.ID).Update("last_used_at", now)
+		apiKey.LastUsedAt = &now
+	}
+	return apiKey, user, nil
+}
+
+// CreateServiceAccount adds a machine user. It gets a placeholder email under the reserved
+// ".invalid" domain (emails are unique) and no password, so it can never log in; an admin
+// gives it API keys instead.
+func CreateServiceAccount(name string, role models.Role) (models.User, error) {
+	return createServiceAccount(helpers.DB(), name, role)
+}
+
+func createServiceAccount(tx *gorm.DB, name string, role models.Role) (models.User, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return models.User{}, err
+	}
+
+	user := models.User{
+		FirstName:      name,
+		LastName:       "(service account)",
+		Email:          "svc-" + hex.EncodeToString(id) + "@service-accounts.invalid",
+		Role:           role,
+		ServiceAccount: true,
+		EmailVerified:  true, // nothing to verify, and REQUIRE_VERIFIED_EMAIL must not block it
+	}
+	if err := tx.Create(&user).Error; err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
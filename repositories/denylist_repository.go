@@ -0,0 +1,114 @@
+package repositories
+
+import (
+	"sync"
+	"time"
+
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// accessDenylist keeps the revoked access token ids in memory, so middleware.IsAuthenticated
+// can check every request without a database query. The revoked_access_tokens table is the
+// source of truth: every write goes there first, and LoadAccessTokenDenylist refills the
+// cache from it on startup.
+var accessDenylist = struct {
+	sync.RWMutex
+	entries map[string]time.Time // jti -> when the token expires anyway
+}{entries: map[string]time.Time{}}
+
+// LoadAccessTokenDenylist fills the in-memory denylist with every entry that has not expired yet.
+// Call it once after database.ConnectDb.
+func LoadAccessTokenDenylist() error {
+	var revoked []models.RevokedAccessToken
+	if err := helpers.DB().Where("expires_at > ?", time.Now()).Find(&revoked).Error; err != nil {
+		return err
+	}
+	rememberRevoked(revoked)
+	return nil
+}
+
+// IsAccessTokenRevoked reports whether the access token with this jti was revoked.
+func IsAccessTokenRevoked(jti string) bool {
+	accessDenylist.RLock()
+	defer accessDenylist.RUnlock()
+
+	expiresAt, found := accessDenylist.entries[jti]
+	return found && time.Now().Before(expiresAt)
+}
+
+// RevokeAccessToken denylists one access token until it expires.
+func RevokeAccessToken(userID uuid.UUID, jti string, expiresAt time.Time) error {
+	if !expiresAt.After(time.Now()) {
+		return nil // already dead
+	}
+	revoked := []models.RevokedAccessToken{{JTI: jti, UserID: userID, ExpiresAt: expiresAt}}
+	if err := storeRevoked(helpers.DB(), revoked); err != nil {
+		return err
+	}
+	rememberRevoked(revoked)
+	return nil
+}
+
+// revokeSessionAccessTokens denylists the access tokens issued alongside the refresh tokens
+// matching condition (e.g. one family). It writes through tx; call rememberRevoked with the
+// result once tx has committed, so a rolled-back revocation never reaches the cache.
+func revokeSessionAccessTokens(tx *gorm.DB, condition string, args ...interface{}) ([]models.RevokedAccessToken, error) {
+	var tokens []models.RefreshToken
+	if err := tx.Where(condition, args...).
+		Where("access_token_id <> '' AND access_token_expires_at > ?", time.Now()).
+		Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+
+	revoked := make([]models.RevokedAccessToken, 0, len(tokens))
+	for _, token := range tokens {
+		revoked = append(revoked, models.RevokedAccessToken{
+			JTI:       token.AccessTokenID,
+			UserID:    token.UserID,
+			ExpiresAt: *token.AccessTokenExpiresAt,
+		})
+	}
+	if err := storeRevoked(tx, revoked); err != nil {
+		return nil, err
+	}
+	return revoked, nil
+}
+
+func storeRevoked(db *gorm.DB, revoked []models.RevokedAccessToken) error {
+	if len(revoked) == 0 {
+		return nil
+	}
+	// Revoking the same token twice (logout after "revoke session") is fine: keep the first row.
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked).Error
+}
+
+func rememberRevoked(revoked []models.RevokedAccessToken) {
+	accessDenylist.Lock()
+	defer accessDenylist.Unlock()
+
+	for _, entry := range revoked {
+		accessDenylist.entries[entry.JTI] = entry.ExpiresAt
+	}
+}
+
+// PurgeRevokedAccessTokens drops denylist entries whose tokens have expired on their own,
+// from the database and from memory. It returns how many rows were deleted.
+func PurgeRevokedAccessTokens(now time.Time) (int64, error) {
+	result := helpers.DB().Where("expires_at < ?", now).Delete(&models.RevokedAccessToken{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	accessDenylist.Lock()
+	defer accessDenylist.Unlock()
+	for jti, expiresAt := range accessDenylist.entries {
+		if expiresAt.Before(now) {
+			delete(accessDenylist.entries, jti)
+		}
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/amanguptak/fiber-api/config"
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrVerificationTokenInvalid = errors.New("verification token is invalid or has expired")
+	ErrVerificationCooldown     = errors.New("a verification email was sent recently, try again later")
+)
+
+// CreateEmailVerificationToken issues a verification token for a user, valid for
+// config.App.EmailVerificationTTL. Older unused tokens stop working, and a new one is refused
+// with ErrVerificationCooldown until config.App.VerificationCooldown has passed since the last,
+// so the resend endpoint cannot be used to flood someone's inbox.
+func CreateEmailVerificationToken(userID uuid.UUID) (string, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	tx := helpers.DB().Begin()
+
+	var recent int64
+	if err := tx.Model(&models.EmailVerificationToken{}).
+		Where("user_id = ? AND created_at > ?", userID, now.Add(-config.App.VerificationCooldown)).
+		Count(&recent).Error; err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	if recent > 0 {
+		tx.Rollback()
+		return "", ErrVerificationCooldown
+	}
+
+	if err := tx.Model(&models.EmailVerificationToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", now).Error; err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	verificationToken := models.EmailVerificationToken{
+		UserID:    userID,
+		TokenHash: HashToken(token),
+		ExpiresAt: now.Add(config.App.EmailVerificationTTL),
+	}
+	if err := tx.Create(&verificationToken).Error; err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// VerifyEmail redeems a verification token and marks the user's email as verified.
+func VerifyEmail(token string) (models.User, error) {
+	now := time.Now()
+	tx := helpers.DB().Begin()
+
+	var verificationToken models.EmailVerificationToken
+	if err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", HashToken(token), now).
+		First(&verificationToken).Error; err != nil {
+		tx.Rollback()
+		return models.User{}, ErrVerificationTokenInvalid
+	}
+
+	// Same single-use guard as ResetPassword.
+	result := tx.Model(&models.EmailVerificationToken{}).
+		Where("id = ? AND used_at IS NULL", verificationToken.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		tx.Rollback()
+		return models.User{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return models.User{}, ErrVerificationTokenInvalid
+	}
+
+	var user models.User
+	if err := tx.Where("id = ?", verificationToken.UserID).First(&user).Error; err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+	user.EmailVerified = true
+	user.EmailVerifiedAt = &now
+	if err := tx.Save(&user).Error; err != nil {
+		tx.Rollback()
+		return models.User{}, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// PurgeEmailVerificationTokens deletes verification tokens that can no longer be redeemed.
+// The newest token of an unverified user stays until it expires, which is what the resend
+// cooldown counts, so the cooldown must stay shorter than EMAIL_VERIFICATION_TTL.
+func PurgeEmailVerificationTokens(now time.Time) (int64, error) {
+	result := helpers.DB().
+		Where("expires_at < ? OR (used_at IS NOT NULL AND created_at < ?)", now, now.Add(-config.App.VerificationCooldown)).
+		Delete(&models.EmailVerificationToken{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,114 @@
+package repositories
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/amanguptak/fiber-api/config"
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"gorm.io/gorm"
+)
+
+// ThrottleKey is one thing failed logins are counted against, with its own limit.
+type ThrottleKey struct {
+	Key         string
+	MaxFailures int
+}
+
+// AccountThrottleKey counts failures per email, whether or not an account exists for it.
+func AccountThrottleKey(email string) ThrottleKey {
+	return ThrottleKey{Key: "email:" + strings.ToLower(strings.TrimSpace(email)), MaxFailures: config.App.LoginMaxFailures}
+}
+
+// IPThrottleKey counts failures per client address. Its limit is higher, because many users
+// can share one address (an office, a mobile carrier).
+func IPThrottleKey(ip string) ThrottleKey {
+	return ThrottleKey{Key: "ip:" + ip, MaxFailures: config.App.LoginIPMaxFailures}
+}
+
+// LoginLockedFor returns how long the caller still has to wait if any of the keys is locked,
+// or 0 when logging in is allowed.
+func LoginLockedFor(keys ...ThrottleKey) (time.Duration, error) {
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, key.Key)
+	}
+
+	var throttles []models.LoginThrottle
+	if err := helpers.DB().Where("key IN ?", names).Find(&throttles).Error; err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	var wait time.Duration
+	for _, throttle := range throttles {
+		if throttle.LockedUntil != nil && throttle.LockedUntil.After(now) {
+			wait = max(wait, throttle.LockedUntil.Sub(now))
+		}
+	}
+	return wait, nil
+}
+
+// RecordLoginFailure counts one failed login against every key. Once a key reaches its limit
+// it is locked for config.App.LoginLockout, and every further failure doubles the lockout
+// (30s, 1m, 2m, ...) up to config.App.LoginMaxLockout.
+func RecordLoginFailure(keys ...ThrottleKey) error {
+	now := time.Now()
+
+	return helpers.DB().Transaction(func(tx *gorm.DB) error {
+		for _, key := range keys {
+			var throttle models.LoginThrottle
+			err := tx.Where("key = ?", key.Key).First(&throttle).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				throttle = models.LoginThrottle{Key: key.Key}
+			} else if err != nil {
+				return err
+			}
+
+			// A long quiet period wipes the slate clean.
+			if now.Sub(throttle.LastFailureAt) > config.App.LoginFailureWindow {
+				throttle.Failures = 0
+			}
+			throttle.Failures++
+			throttle.LastFailureAt = now
+
+			if over := throttle.Failures - key.MaxFailures; over >= 0 {
+				lockedUntil := now.Add(lockoutFor(over))
+				throttle.LockedUntil = &lockedUntil
+			}
+
+			if err := tx.Save(&throttle).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ResetLoginFailures forgets the failures of keys, e.g. of the account after a successful login.
+func ResetLoginFailures(keys ...ThrottleKey) error {
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, key.Key)
+	}
+	return helpers.DB().Where("key IN ?", names).Delete(&models.LoginThrottle{}).Error
+}
+
+// PurgeLoginThrottles deletes counters that are neither locked nor recent enough to matter.
+func PurgeLoginThrottles(now time.Time) (int64, error) {
+	result := helpers.DB().
+		Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-config.App.LoginFailureWindow), now).
+		Delete(&models.LoginThrottle{})
+	return result.RowsAffected, result.Error
+}
+
+// lockoutFor is the lockout after reaching the limit and failing over more times since.
+func lockoutFor(over int) time.Duration {
+	lockout := config.App.LoginLockout
+	for i := 0; i < over && lockout < config.App.LoginMaxLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, config.App.LoginMaxLockout)
+}
@@ -0,0 +1,134 @@
+package repositories
+
+import (
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/amanguptak/fiber-api/config"
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMagicLinkInvalid      = errors.New("login link is invalid, expired or already used")
+	ErrMagicLinkOtherBrowser = errors.New("open the login link in the browser you requested it from")
+	ErrMagicLinkRateLimited  = errors.New("too many login links were sent recently, try again later")
+	ErrMagicLinkUnverified   = errors.New("verify your email address before logging in with a login link")
+)
+
+// NewMagicLinkNonce returns a fresh random nonce for the browser cookie a login link is bound to.
+func NewMagicLinkNonce() (string, error) {
+	return newOpaqueToken()
+}
+
+// CreateMagicLink issues a login link token for a user, bound to the browser holding nonce and
+// valid for config.App.MagicLinkTTL. Older unused links of the user stop working. At most
+// config.App.MagicLinkPerHour links are issued per hour, after that ErrMagicLinkRateLimited,
+// so the endpoint cannot be used to flood someone's inbox.
+func CreateMagicLink(userID uuid.UUID, nonce string) (string, error) {
+	now := time.Now()
+	tx := helpers.DB().Begin()
+
+	var recent int64
+	if err := tx.Model(&models.MagicLinkToken{}).
+		Where("user_id = ? AND created_at > ?", userID, now.Add(-time.Hour)).
+		Count(&recent).Error; err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	if recent >= int64(config.App.MagicLinkPerHour) {
+		tx.Rollback()
+		return "", ErrMagicLinkRateLimited
+	}
+
+	if err := tx.Model(&models.MagicLinkToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", now).Error; err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	token, claims, err := helpers.IssueToken(helpers.MagicLinkToken, userID.String(), "", now.Add(config.App.MagicLinkTTL))
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	magicLink := models.MagicLinkToken{
+		UserID:    userID,
+		TokenID:   claims.ID,
+		NonceHash: HashToken(nonce),
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	if err := tx.Create(&magicLink).Error; err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeMagicLink redeems a login link whose signature was already checked (claims from
+// helpers.ParseToken) and returns its user. nonce is the one from the browser's cookie. A link
+// opened in another browser is refused without being used up, so the right browser can still
+// use it. An account whose email is not verified is refused (ErrMagicLinkUnverified): anyone
+// can register with someone else's address, and whoever set that account's password would keep
+// access to it once the owner started logging in with links.
+func ConsumeMagicLink(claims *helpers.Claims, nonce string) (models.User, error) {
+	now := time.Now()
+	tx := helpers.DB().Begin()
+
+	var magicLink models.MagicLinkToken
+	if err := tx.Where("token_id = ? AND user_id = ? AND used_at IS NULL AND expires_at > ?", claims.ID, claims.Subject, now).
+		First(&magicLink).Error; err != nil {
+		tx.Rollback()
+		return models.User{}, ErrMagicLinkInvalid
+	}
+
+	if subtle.ConstantTimeCompare([]byte(magicLink.NonceHash), []byte(HashToken(nonce))) != 1 {
+		tx.Rollback()
+		return models.User{}, ErrMagicLinkOtherBrowser
+	}
+
+	// Two requests with the same link cannot both get past this line.
+	result := tx.Model(&models.MagicLinkToken{}).
+		Where("id = ? AND used_at IS NULL", magicLink.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		tx.Rollback()
+		return models.User{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return models.User{}, ErrMagicLinkInvalid
+	}
+
+	var user models.User
+	if err := tx.Where("id = ? AND service_account = ?", magicLink.UserID, false).First(&user).Error; err != nil {
+		tx.Rollback()
+		return models.User{}, ErrMagicLinkInvalid
+	}
+	if !user.EmailVerified {
+		tx.Rollback()
+		return models.User{}, ErrMagicLinkUnverified
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// PurgeMagicLinks deletes login links that can no longer be used. Rows younger than an hour
+// are kept even then, because CreateMagicLink counts them for its hourly limit.
+func PurgeMagicLinks(now time.Time) (int64, error) {
+	result := helpers.DB().
+		Where("(expires_at < ? OR used_at IS NOT NULL) AND created_at < ?", now, now.Add(-time.Hour)).
+		Delete(&models.MagicLinkToken{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,232 @@
+package repositories
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrInvalidMFACode    = errors.New("invalid two-factor authentication code")
+)
+
+// recoveryCodeCount is how many recovery codes a user gets when enabling TOTP.
+const recoveryCodeCount = 10
+
+// HasTOTP reports whether the user has a confirmed authenticator app. Callers must treat an
+// error as "unknown" and fail closed, never as "no second factor".
+func HasTOTP(userID uuid.UUID) (bool, error) {
+	var count int64
+	err := helpers.DB().Model(&models.TOTPCredential{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// EnrollTOTP starts (or restarts) setting up an authenticator app and returns the new secret.
+// Nothing changes for login until ConfirmTOTP succeeds.
+func EnrollTOTP(userID uuid.UUID) (string, error) {
+	enabled, err := HasTOTP(userID)
+	if err != nil {
+		return "", err
+	}
+	if enabled {
+		return "", ErrMFAAlreadyEnabled
+	}
+
+	secret, err := helpers.GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+
+	credential := models.TOTPCredential{UserID: userID, Secret: secret, CreatedAt: time.Now()}
+	// Save inserts or replaces the unconfirmed credential from an earlier, abandoned enrollment.
+	if err := helpers.DB().Save(&credential).Error; err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// ConfirmTOTP turns TOTP on once the user proves the app works by sending a current code.
+// It returns the recovery codes in clear text; this is the only time they can be shown.
+func ConfirmTOTP(userID uuid.UUID, code string) ([]string, error) {
+	tx := helpers.DB().Begin()
+
+	var credential models.TOTPCredential
+	if err := tx.Where("user_id = ?", userID).First(&credential).Error; err != nil {
+		tx.Rollback()
+		return nil, ErrMFANotEnabled
+	}
+	if credential.ConfirmedAt != nil {
+		tx.Rollback()
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	now := time.Now()
+	step, ok := helpers.ValidateTOTP(credential.Secret, code, now)
+	if !ok {
+		tx.Rollback()
+		return nil, ErrInvalidMFACode
+	}
+
+	credential.ConfirmedAt = &now
+	credential.LastUsedStep = step
+	if err := tx.Save(&credential).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifyMFACode accepts either a TOTP code or an unused recovery code for the user.
+// Each TOTP code and each recovery code works only once.
+func VerifyMFACode(userID uuid.UUID, code string) error {
+	var credential models.TOTPCredential
+	if err := helpers.DB().Where("user_id = ? AND confirmed_at IS NOT NULL", userID).First(&credential).Error; err != nil {
+		return ErrMFANotEnabled
+	}
+
+	if step, ok := helpers.ValidateTOTP(credential.Secret, code, time.Now()); ok {
+		// Conditional update: a replay of the same code (or an older one) matches 0 rows.
+		result := helpers.DB().Model(&models.TOTPCredential{}).
+			Where("user_id = ? AND last_used_step < ?", userID, step).
+			Update("last_used_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			return nil
+		}
+		return ErrInvalidMFACode
+	}
+
+	result := helpers.DB().Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil
+	}
+	return ErrInvalidMFACode
+}
+
+// DisableTOTP turns two-factor authentication off after checking a code (TOTP or recovery),
+// so a stolen access token alone is not enough to remove it.
+func DisableTOTP(userID uuid.UUID, code string) error {
+	if err := VerifyMFACode(userID, code); err != nil {
+		return err
+	}
+
+	return helpers.DB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.TOTPCredential{}).Error
+	})
+}
+
+// replaceRecoveryCodes deletes the user's old recovery codes and stores a fresh set.
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		rows = append(rows, models.RecoveryCode{UserID: userID, CodeHash: HashToken(normalizeRecoveryCode(code))})
+	}
+
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// newRecoveryCode returns 80 random bits as "abcd-efgh-ijkl-mnop". That is enough entropy
+// for a plain SHA-256 to be safe, unlike a password.
+func newRecoveryCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	raw := strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+	return raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16], nil
+}
+
+// normalizeRecoveryCode accepts the code with or without dashes, spaces and capitals.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// mfaFailures counts wrong codes per "mfa pending" token, so the 6-digit code cannot be
+// guessed by trying all million of them within the token's lifetime.
+var mfaFailures = struct {
+	sync.Mutex
+	entries map[string]mfaFailure
+}{entries: map[string]mfaFailure{}}
+
+type mfaFailure struct {
+	count     int
+	expiresAt time.Time
+}
+
+// RecordMFAFailure counts one wrong code for the pending token jti and returns the total so far.
+func RecordMFAFailure(jti string, expiresAt time.Time) int {
+	mfaFailures.Lock()
+	defer mfaFailures.Unlock()
+
+	now := time.Now()
+	for key, entry := range mfaFailures.entries {
+		if entry.expiresAt.Before(now) {
+			delete(mfaFailures.entries, key)
+		}
+	}
+
+	entry := mfaFailures.entries[jti]
+	entry.count++
+	entry.expiresAt = expiresAt
+	mfaFailures.entries[jti] = entry
+	return entry.count
+}
+
+// MFAFailureCount returns the wrong codes counted for key so far, 0 once its window has passed.
+// Check it before testing a code: a guess made after the limit must not be tried at all.
+func MFAFailureCount(key string) int {
+	mfaFailures.Lock()
+	defer mfaFailures.Unlock()
+
+	entry, ok := mfaFailures.entries[key]
+	if !ok || entry.expiresAt.Before(time.Now()) {
+		return 0
+	}
+	return entry.count
+}
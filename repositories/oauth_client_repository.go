@@ -0,0 +1,183 @@
+package repositories
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/amanguptak/fiber-api/config"
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOAuthClientNotFound = errors.New("oauth client does not exist")
+	ErrInvalidClient       = errors.New("invalid client credentials")
+)
+
+// CreateOAuthClient registers a client together with the service account it acts as, and
+// returns its secret in clear text; like an API key, it is never shown again.
+func CreateOAuthClient(name string, role models.Role, scopes []string, createdByID uuid.UUID) (string, models.OAuthClient, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", models.OAuthClient{}, err
+	}
+	secret, err := newOpaqueToken()
+	if err != nil {
+		return "", models.OAuthClient{}, err
+	}
+
+	client := models.OAuthClient{
+		ClientID:    "client_" + hex.EncodeToString(id),
+		Name:        name,
+		SecretHash:  HashToken(secret),
+		Scopes:      strings.Join(scopes, " "),
+		CreatedByID: createdByID,
+	}
+	err = helpers.DB().Transaction(func(tx *gorm.DB) error {
+		user, err := createServiceAccount(tx, name, role)
+		if err != nil {
+			return err
+		}
+		client.UserID = user.ID
+		return tx.Create(&client).Error
+	})
+	if err != nil {
+		return "", models.OAuthClient{}, err
+	}
+	return secret, client, nil
+}
+
+// ListOAuthClients returns every client, revoked ones included, newest first.
+func ListOAuthClients() ([]models.OAuthClient, error) {
+	var clients []models.OAuthClient
+	err := helpers.DB().Order("created_at desc").Find(&clients).Error
+	return clients, err
+}
+
+// AuthenticateOAuthClient checks a client's credentials and returns the client.
+func AuthenticateOAuthClient(clientID string, secret string) (models.OAuthClient, error) {
+	var client models.OAuthClient
+	if err := helpers.DB().Where("client_id = ? AND revoked_at IS NULL", clientID).First(&client).Error; err != nil {
+		return models.OAuthClient{}, ErrInvalidClient
+	}
+	if subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(HashToken(secret))) != 1 {
+		return models.OAuthClient{}, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// RevokeOAuthClient stops a client from getting tokens, and revokes the ones it has:
+// its refresh tokens, and the access tokens issued with them.
+func RevokeOAuthClient(id uuid.UUID) error {
+	tx := helpers.DB().Begin()
+
+	var client models.OAuthClient
+	if err := tx.Where("id = ? AND revoked_at IS NULL", id).First(&client).Error; err != nil {
+		tx.Rollback()
+		return ErrOAuthClientNotFound
+	}
+
+	result := tx.Model(&models.OAuthClient{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		tx.Rollback()
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return ErrOAuthClientNotFound
+	}
+
+	if err := tx.Model(&models.RefreshToken{}).
+		Where("client_id = ? AND is_revoked = ?", client.ClientID, false).
+		Update("is_revoked", true).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	revoked, err := revokeSessionAccessTokens(tx, "client_id = ?", client.ClientID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	rememberRevoked(revoked)
+	return nil
+}
+
+// IssueClientTokens mints an access/refresh pair for a client (client_credentials grant).
+// The refresh token starts a family like a login does, so revoking it also denylists the
+// access tokens rotated from it.
+func IssueClientTokens(client models.OAuthClient, scopes []string, info ClientInfo) (TokenGrant, error) {
+	var user models.User
+	if err := helpers.DB().Where("id = ?", client.UserID).First(&user).Error; err != nil {
+		return TokenGrant{}, err
+	}
+
+	accessToken, accessClaims, err := helpers.IssueClientToken(helpers.AccessToken, user.ID.String(), string(user.Role), client.ClientID, scopes, time.Now().Add(config.App.AccessTokenTTL))
+	if err != nil {
+		return TokenGrant{}, err
+	}
+
+	refreshExpiresAt := time.Now().Add(config.App.RefreshTokenTTL)
+	refreshToken, err := helpers.GenerateToken(helpers.RefreshToken, user.ID.String(), string(user.Role), refreshExpiresAt)
+	if err != nil {
+		return TokenGrant{}, err
+	}
+
+	dbToken := models.RefreshToken{
+		UserID:               user.ID,
+		TokenHash:            HashToken(refreshToken),
+		ExpiresAt:            refreshExpiresAt,
+		IPAddress:            info.IPAddress,
+		UserAgent:            info.UserAgent,
+		AccessTokenID:        accessClaims.ID,
+		AccessTokenExpiresAt: &accessClaims.ExpiresAt.Time,
+		ClientID:             client.ClientID,
+		Scope:                strings.Join(scopes, " "),
+	}
+	if err := helpers.DB().Create(&dbToken).Error; err != nil {
+		return TokenGrant{}, err
+	}
+	return TokenGrant{AccessToken: accessToken, RefreshToken: refreshToken, Scopes: scopes}, nil
+}
+
+// RotateClientRefreshToken is the refresh_token grant: RotateRefreshToken, limited to the
+// tokens of clientID. scopes, if not nil, narrows the new access token.
+func RotateClientRefreshToken(token string, clientID string, scopes []string, info ClientInfo) (TokenGrant, error) {
+	return rotateRefreshToken(token, info, clientID, scopes)
+}
+
+// ClientRefreshToken returns a refresh token of clientID that can still be used.
+func ClientRefreshToken(token string, clientID string) (models.RefreshToken, error) {
+	var dbToken models.RefreshToken
+	if err := helpers.DB().
+		Where("token_hash = ? AND client_id = ? AND is_revoked = ? AND expires_at > ?", HashToken(token), clientID, false, time.Now()).
+		First(&dbToken).Error; err != nil {
+		return models.RefreshToken{}, ErrTokenNotFound
+	}
+	return dbToken, nil
+}
+
+// RevokeClientRefreshToken revokes the family of a refresh token of clientID, with its access tokens.
+func RevokeClientRefreshToken(token string, clientID string) error {
+	var dbToken models.RefreshToken
+	if err := helpers.DB().Where("token_hash = ? AND client_id = ?", HashToken(token), clientID).First(&dbToken).Error; err != nil {
+		return ErrTokenNotFound
+	}
+
+	err := RevokeSession(dbToken.UserID, dbToken.FamilyID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil // already revoked
+	}
+	return err
+}
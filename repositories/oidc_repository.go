@@ -0,0 +1,154 @@
+package repositories
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOIDCStateInvalid    = errors.New("sign-in attempt is invalid or has expired")
+	ErrOIDCEmailUnverified = errors.New("the identity provider has not verified this email address")
+	ErrOIDCLinkRefused     = errors.New("this account cannot sign in with an identity provider")
+	ErrOIDCLinkUnverified  = errors.New("an account with this email address exists, but the address is not verified yet; verify it, then sign in again")
+)
+
+// OIDCLoginTTL is how long a user has to finish signing in at the provider.
+const OIDCLoginTTL = 10 * time.Minute
+
+// ExternalProfile is what the identity provider told us about the user in the ID token.
+type ExternalProfile struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+}
+
+// CreateOIDCLoginState starts a sign-in attempt and returns its state parameter.
+func CreateOIDCLoginState(nonce string, codeVerifier string) (string, error) {
+	state, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	loginState := models.OIDCLoginState{
+		StateHash:    HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(OIDCLoginTTL),
+	}
+	if err := helpers.DB().Create(&loginState).Error; err != nil {
+		return "", err
+	}
+	return state, nil
+}
+
+// ConsumeOIDCLoginState looks up and deletes the attempt of a callback's state parameter,
+// so a callback URL (and its code) works only once.
+func ConsumeOIDCLoginState(state string) (models.OIDCLoginState, error) {
+	tx := helpers.DB().Begin()
+
+	var loginState models.OIDCLoginState
+	if err := tx.Where("state_hash = ? AND expires_at > ?", HashToken(state), time.Now()).
+		First(&loginState).Error; err != nil {
+		tx.Rollback()
+		return models.OIDCLoginState{}, ErrOIDCStateInvalid
+	}
+
+	result := tx.Where("state_hash = ?", loginState.StateHash).Delete(&models.OIDCLoginState{})
+	if result.Error != nil {
+		tx.Rollback()
+		return models.OIDCLoginState{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return models.OIDCLoginState{}, ErrOIDCStateInvalid
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return models.OIDCLoginState{}, err
+	}
+	return loginState, nil
+}
+
+// PurgeOIDCLoginStates deletes sign-in attempts that were never finished.
+func PurgeOIDCLoginStates(now time.Time) (int64, error) {
+	result := helpers.DB().Where("expires_at < ?", now).Delete(&models.OIDCLoginState{})
+	return result.RowsAffected, result.Error
+}
+
+// UserForExternalIdentity returns the user an external account signs in as:
+//  1. the user already linked to this issuer and subject;
+//  2. otherwise the user with the same email, which gets linked now;
+//  3. otherwise a new user, created without a password.
+//
+// 2 and 3 need an email the provider has verified. Anyone can type any address into an account
+// at some provider, and linking on that would hand them the account that owns the address.
+// 2 also needs an account that verified the address itself: anyone can register with someone
+// else's address too, and if the owner then signed in here, whoever knows that password would
+// share the account with them (ErrOIDCLinkUnverified).
+func UserForExternalIdentity(profile ExternalProfile) (models.User, error) {
+	now := time.Now()
+	var user models.User
+
+	err := helpers.DB().Transaction(func(tx *gorm.DB) error {
+		var identity models.ExternalIdentity
+		err := tx.Where("issuer = ? AND subject = ?", profile.Issuer, profile.Subject).First(&identity).Error
+		if err == nil {
+			if err := tx.Where("id = ?", identity.UserID).First(&user).Error; err != nil {
+				return err
+			}
+			return tx.Model(&identity).Update("last_login_at", now).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if !profile.EmailVerified || profile.Email == "" {
+			return ErrOIDCEmailUnverified
+		}
+
+		err = tx.Where("LOWER(email) = ?", strings.ToLower(profile.Email)).First(&user).Error
+		switch {
+		case err == nil:
+			if user.ServiceAccount {
+				return ErrOIDCLinkRefused
+			}
+			if !user.EmailVerified {
+				return ErrOIDCLinkUnverified
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			user = models.User{
+				FirstName:       profile.FirstName,
+				LastName:        profile.LastName,
+				Email:           profile.Email,
+				EmailVerified:   true,
+				EmailVerifiedAt: &now,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		identity = models.ExternalIdentity{
+			UserID:      user.ID,
+			Issuer:      profile.Issuer,
+			Subject:     profile.Subject,
+			Email:       profile.Email,
+			LastLoginAt: now,
+		}
+		return tx.Create(&identity).Error
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
@@ -0,0 +1,204 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrProductNotFound   = errors.New("product does not exist")
+	ErrOrderNotFound     = errors.New("order does not exist")
+	ErrIllegalTransition = errors.New("illegal order status transition")
+	ErrInsufficientStock = errors.New("insufficient stock")
+)
+
+// WithOrderDetails preloads everything the order API returns: the items and the status history, oldest first.
+// Use it as a scope: helpers.DB().Scopes(repositories.WithOrderDetails).Find(&orders)
+func WithOrderDetails(db *gorm.DB) *gorm.DB {
+	return db.Preload("Items").Preload("StatusHistory", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at asc")
+	})
+}
+
+// OrderLine is one requested product and how many of it the caller wants.
+type OrderLine struct {
+	ProductID uuid.UUID
+	Quantity  int
+}
+
+// CreateOrder builds an order with one item per product, copying each product's
+// current name and price onto the item, and stores everything in one transaction.
+// Stock is reserved in the same transaction, so the order and the stock change commit or fail together.
+func CreateOrder(userID uuid.UUID, lines []OrderLine) (models.Order, error) {
+	order := models.Order{
+		UserID: userID,
+		Status: models.OrderPending,
+		// The first history row records who created the order.
+		StatusHistory: []models.OrderStatusChange{{ToStatus: models.OrderPending, ChangedByID: userID}},
+	}
+
+	// Merge repeated products into one line so the basket has a single row per product.
+	quantities := make(map[uuid.UUID]int)
+	productOrder := make([]uuid.UUID, 0, len(lines))
+	for _, line := range lines {
+		if _, seen := quantities[line.ProductID]; !seen {
+			productOrder = append(productOrder, line.ProductID)
+		}
+		quantities[line.ProductID] += line.Quantity
+	}
+
+	tx := helpers.DB().Begin()
+
+	var total models.Money
+	for _, productID := range productOrder {
+		quantity := quantities[productID]
+
+		if err := reserveStock(tx, productID, quantity); err != nil {
+			tx.Rollback()
+			return models.Order{}, err
+		}
+
+		var product models.Product
+		if err := tx.Where("id = ?", productID).First(&product).Error; err != nil {
+			tx.Rollback()
+			return models.Order{}, err
+		}
+
+		lineTotal, err := product.Price.Mul(int64(quantity))
+		if err != nil {
+			tx.Rollback()
+			return models.Order{}, err
+		}
+		if total, err = total.Add(lineTotal); err != nil {
+			tx.Rollback()
+			return models.Order{}, err
+		}
+
+		order.Items = append(order.Items, models.OrderItem{
+			ProductID:   product.ID,
+			ProductName: product.Name,
+			Quantity:    quantity,
+			UnitPrice:   product.Price,
+		})
+	}
+	order.Total = total
+
+	// Create also inserts order.Items and order.StatusHistory because they are has-many associations.
+	if err := tx.Create(&order).Error; err != nil {
+		tx.Rollback()
+		return models.Order{}, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return models.Order{}, err
+	}
+	return order, nil
+}
+
+// reserveStock takes quantity units of a product with one conditional UPDATE.
+// "stock >= ?" is checked by the database at the moment of the write, so two concurrent
+// orders for the last unit cannot both succeed: the second one matches 0 rows.
+// Reading the stock first and then writing it back would leave a gap where both requests see 1.
+func reserveStock(tx *gorm.DB, productID uuid.UUID, quantity int) error {
+	result := tx.Model(&models.Product{}).
+		Where("id = ? AND stock >= ?", productID, quantity).
+		Update("stock", gorm.Expr("stock - ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil
+	}
+
+	// 0 rows: either the product is gone or there is not enough stock left.
+	var count int64
+	if err := tx.Model(&models.Product{}).Where("id = ?", productID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: %s", ErrProductNotFound, productID)
+	}
+	return fmt.Errorf("%w for product %s", ErrInsufficientStock, productID)
+}
+
+// releaseStock puts the items of a cancelled order back on the shelf.
+// Products deleted since the order was placed are skipped.
+func releaseStock(tx *gorm.DB, orderID uuid.UUID) error {
+	var items []models.OrderItem
+	if err := tx.Where("order_id = ?", orderID).Find(&items).Error; err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := tx.Model(&models.Product{}).
+			Where("id = ?", item.ProductID).
+			Update("stock", gorm.Expr("stock + ?", item.Quantity)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TransitionOrder moves an order to the next status if the transition table allows it,
+// and records who did it in the order's status history. Cancelling an order releases its stock.
+func TransitionOrder(orderID uuid.UUID, actorID uuid.UUID, next models.OrderStatus) (models.Order, error) {
+	tx := helpers.DB().Begin()
+
+	var order models.Order
+	if err := tx.Where("id = ?", orderID).First(&order).Error; err != nil {
+		tx.Rollback()
+		return models.Order{}, ErrOrderNotFound
+	}
+
+	if !order.Status.CanTransitionTo(next) {
+		tx.Rollback()
+		return models.Order{}, fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, order.Status, next)
+	}
+
+	// Only update if the status is still the one we checked.
+	// If another request moved the order in the meantime, RowsAffected is 0 and we refuse.
+	result := tx.Model(&models.Order{}).
+		Where("id = ? AND status = ?", order.ID, order.Status).
+		Update("status", next)
+	if result.Error != nil {
+		tx.Rollback()
+		return models.Order{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return models.Order{}, fmt.Errorf("%w: order status changed concurrently", ErrIllegalTransition)
+	}
+
+	if next == models.OrderCancelled {
+		if err := releaseStock(tx, order.ID); err != nil {
+			tx.Rollback()
+			return models.Order{}, err
+		}
+	}
+
+	change := models.OrderStatusChange{
+		OrderID:     order.ID,
+		FromStatus:  order.Status,
+		ToStatus:    next,
+		ChangedByID: actorID,
+	}
+	if err := tx.Create(&change).Error; err != nil {
+		tx.Rollback()
+		return models.Order{}, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return models.Order{}, err
+	}
+
+	var updated models.Order
+	if err := helpers.DB().Scopes(WithOrderDetails).First(&updated, "id = ?", order.ID).Error; err != nil {
+		return models.Order{}, err
+	}
+	return updated, nil
+}
@@ -0,0 +1,96 @@
+package repositories
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/amanguptak/fiber-api/config"
+	"github.com/amanguptak/fiber-api/database"
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB migrates a fresh SQLite file, opened by database.ConnectDb with the same DSN
+// (_txlock=immediate&_busy_timeout=5000) as the server, so locking behaves like production.
+func openTestDB(t *testing.T) {
+	t.Helper()
+
+	previous := config.App
+	config.App.DBPath = filepath.Join(t.TempDir(), "test.db")
+	database.ConnectDb()
+	database.Database.Db.Logger = logger.Default.LogMode(logger.Silent)
+
+	t.Cleanup(func() {
+		if sqlDB, err := database.Database.Db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		config.App = previous
+	})
+}
+
+func TestCreateOrderReservesTheLastUnitOnce(t *testing.T) {
+	openTestDB(t)
+
+	buyer := models.User{FirstName: "Al", LastName: "Bo", Email: "buyer@example.com"}
+	if err := helpers.DB().Create(&buyer).Error; err != nil {
+		t.Fatal(err)
+	}
+	price, err := models.NewMoney(1999, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	product := models.Product{Name: "Last one", Price: price, Stock: 1}
+	if err := helpers.DB().Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Both orders start together; exactly one of them may get the unit.
+	const buyers = 2
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, buyers)
+	for range buyers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := CreateOrder(buyer.ID, []OrderLine{{ProductID: product.ID, Quantity: 1}})
+			errs <- err
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	var succeeded, outOfStock int
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ErrInsufficientStock):
+			outOfStock++
+		default:
+			t.Errorf("CreateOrder: unexpected error %v", err)
+		}
+	}
+	if succeeded != 1 || outOfStock != 1 {
+		t.Errorf("got %d successful and %d insufficient-stock orders, want 1 and 1", succeeded, outOfStock)
+	}
+
+	var stock models.Product
+	if err := helpers.DB().Where("id = ?", product.ID).First(&stock).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stock.Stock != 0 {
+		t.Errorf("stock = %d, want 0", stock.Stock)
+	}
+
+	var orders int64
+	helpers.DB().Model(&models.Order{}).Where("user_id = ?", buyer.ID).Count(&orders)
+	if orders != 1 {
+		t.Errorf("%d orders stored, want 1", orders)
+	}
+}
@@ -0,0 +1,35 @@
+package repositories
+
+import (
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/amanguptak/fiber-api/password"
+)
+
+// hashParamsPrefix is the part of a stored hash before its salt: algorithm and parameters.
+// For Argon2id that runs to the fourth "$" ("$argon2id$v=19$m=19456,t=2,p=1$"); every other
+// hash we know is bcrypt, whose prefix is 7 characters long ("$2a$12$").
+const hashParamsPrefix = `CASE WHEN password LIKE '$argon2id$%'
+	THEN substr(password, 1, 10 + instr(substr(password, 11), '$') + instr(substr(password, 11 + instr(substr(password, 11), '$')), '$'))
+	ELSE substr(password, 1, 7) END`
+
+// RefreshDummyPasswordHash tells the password package which algorithms and parameters stored
+// hashes still use, so logins for unknown emails cost as much as the slowest of them. One
+// sample per parameter prefix is enough; SQLite returns an arbitrary row of each group.
+func RefreshDummyPasswordHash() error {
+	samples, err := passwordHashSamples()
+	if err != nil {
+		return err
+	}
+	password.UseStoredHashes(samples)
+	return nil
+}
+
+func passwordHashSamples() ([][]byte, error) {
+	var samples [][]byte
+	err := helpers.DB().Model(&models.User{}).
+		Where("password IS NOT NULL AND length(password) > 0").
+		Group(hashParamsPrefix).
+		Pluck("password", &samples).Error
+	return samples, err
+}
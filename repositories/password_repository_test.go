@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/amanguptak/fiber-api/password"
+)
+
+func TestPasswordHashSamplesOnePerParameters(t *testing.T) {
+	openTestDB(t)
+
+	hashers := []password.Hasher{
+		password.NewArgon2id(),
+		password.NewArgon2id(),
+		password.Argon2id{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+		password.Bcrypt{Cost: 4},
+		password.Bcrypt{Cost: 4},
+		password.Bcrypt{Cost: 5},
+	}
+	for i, hasher := range hashers {
+		hash, err := hasher.Hash("Corr3ct-horse-42")
+		if err != nil {
+			t.Fatal(err)
+		}
+		user := models.User{FirstName: "Al", LastName: "Bo", Email: fmt.Sprintf("user%d@example.com", i), Password: []byte(hash)}
+		if err := helpers.DB().Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Accounts from an identity provider have no password and no say in the dummy hash.
+	if err := helpers.DB().Create(&models.User{FirstName: "No", LastName: "Password", Email: "sso@example.com"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := passwordHashSamples()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prefixes []string
+	for _, sample := range samples {
+		// Everything up to the salt: "$2a$04$" or "$argon2id$v=19$m=...,t=...,p=...$".
+		hash := string(sample)
+		if strings.HasPrefix(hash, "$argon2id$") {
+			parts := strings.Split(hash, "$")
+			prefixes = append(prefixes, strings.Join(parts[:4], "$")+"$")
+		} else {
+			prefixes = append(prefixes, hash[:7])
+		}
+	}
+	slices.Sort(prefixes)
+
+	want := []string{"$2a$04$", "$2a$05$", "$argon2id$v=19$m=19456,t=2,p=1$", "$argon2id$v=19$m=8192,t=1,p=1$"}
+	if !slices.Equal(prefixes, want) {
+		t.Errorf("samples with prefixes %q, want %q", prefixes, want)
+	}
+}
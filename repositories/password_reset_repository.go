@@ -0,0 +1,121 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/amanguptak/fiber-api/config"
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrResetTokenInvalid = errors.New("reset token is invalid or has expired")
+	ErrResetRateLimited  = errors.New("too many password reset emails were sent recently, try again later")
+)
+
+// CreatePasswordResetToken issues a reset token for a user, valid for config.App.PasswordResetTTL.
+// Any older unused token of the user stops working, so only the newest email is good. At most
+// config.App.PasswordResetPerHour tokens are issued per hour, after that ErrResetRateLimited:
+// otherwise anyone could flood a victim's inbox and keep replacing the link they are about to use.
+func CreatePasswordResetToken(userID uuid.UUID) (string, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	tx := helpers.DB().Begin()
+
+	var recent int64
+	if err := tx.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND created_at > ?", userID, now.Add(-time.Hour)).
+		Count(&recent).Error; err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	if recent >= int64(config.App.PasswordResetPerHour) {
+		tx.Rollback()
+		return "", ErrResetRateLimited
+	}
+
+	if err := tx.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", now).Error; err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	resetToken := models.PasswordResetToken{
+		UserID:    userID,
+		TokenHash: HashToken(token),
+		ExpiresAt: now.Add(config.App.PasswordResetTTL),
+	}
+	if err := tx.Create(&resetToken).Error; err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ResetPassword redeems a reset token: it stores the new password hash and logs the user out
+// everywhere (all refresh tokens and their access tokens), since whoever knew the old password
+// may still be signed in. It returns the id of the user whose password changed.
+func ResetPassword(token string, passwordHash []byte) (uuid.UUID, error) {
+	now := time.Now()
+	tx := helpers.DB().Begin()
+
+	var resetToken models.PasswordResetToken
+	if err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", HashToken(token), now).
+		First(&resetToken).Error; err != nil {
+		tx.Rollback()
+		return uuid.Nil, ErrResetTokenInvalid
+	}
+
+	// Mark it used only if nobody else did in the meantime: two requests with the same token
+	// cannot both get past this line.
+	result := tx.Model(&models.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", resetToken.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		tx.Rollback()
+		return uuid.Nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return uuid.Nil, ErrResetTokenInvalid
+	}
+
+	if err := tx.Model(&models.User{}).
+		Where("id = ?", resetToken.UserID).
+		Update("password", passwordHash).Error; err != nil {
+		tx.Rollback()
+		return uuid.Nil, err
+	}
+
+	_, revoked, err := revokeSessions(tx, resetToken.UserID, uuid.Nil)
+	if err != nil {
+		tx.Rollback()
+		return uuid.Nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return uuid.Nil, err
+	}
+	rememberRevoked(revoked)
+	return resetToken.UserID, nil
+}
+
+// PurgePasswordResetTokens deletes reset tokens that can no longer be redeemed. Rows younger than
+// an hour are kept even then, because CreatePasswordResetToken counts them for its hourly limit.
+func PurgePasswordResetTokens(now time.Time) (int64, error) {
+	result := helpers.DB().
+		Where("(expires_at < ? OR used_at IS NOT NULL) AND created_at < ?", now, now.Add(-time.Hour)).
+		Delete(&models.PasswordResetToken{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,174 @@
+package repositories
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/amanguptak/fiber-api/helpers"
+	"github.com/amanguptak/fiber-api/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrSessionNotFound = errors.New("session does not exist")
+
+// Session is one login on one device: a refresh token family seen as a whole.
+// Its ID is the family id, so revoking a session revokes every token in that family.
+type Session struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	CreatedAt  time.Time // when the user logged in
+	LastUsedAt time.Time // last login or refresh
+	ExpiresAt  time.Time // when the newest refresh token runs out
+	IPAddress  string    // from the newest token
+	UserAgent  string
+}
+
+// ListSessions returns a user's active sessions, most recently used first.
+// A session is active while at least one of its tokens is unrevoked and unexpired.
+func ListSessions(userID uuid.UUID) ([]Session, error) {
+	activeFamilies := helpers.DB().Model(&models.RefreshToken{}).
+		Select("family_id").
+		Where("user_id = ? AND is_revoked = ? AND expires_at > ?", userID, false, time.Now())
+
+	var tokens []models.RefreshToken
+	if err := helpers.DB().
+		Where("user_id = ? AND family_id IN (?)", userID, activeFamilies).
+		Order("created_at asc").
+		Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+
+	byFamily := map[uuid.UUID]*Session{}
+	var sessions []*Session
+	for _, token := range tokens {
+		session, ok := byFamily[token.FamilyID]
+		if !ok {
+			// Tokens are sorted oldest first, so the first one we see is the login.
+			session = &Session{ID: token.FamilyID, UserID: token.UserID, CreatedAt: token.CreatedAt}
+			byFamily[token.FamilyID] = session
+			sessions = append(sessions, session)
+		}
+
+		session.LastUsedAt = latest(session.LastUsedAt, token.CreatedAt)
+		if token.RotatedAt != nil {
+			session.LastUsedAt = latest(session.LastUsedAt, *token.RotatedAt)
+		}
+		if !token.IsRevoked {
+			session.ExpiresAt = latest(session.ExpiresAt, token.ExpiresAt)
+			session.IPAddress = token.IPAddress
+			session.UserAgent = token.UserAgent
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+
+	result := make([]Session, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, *session)
+	}
+	return result, nil
+}
+
+// SessionIDForAccessToken finds the login session (family) of userID that handed out the access
+// token with this jti. Each refresh token remembers the access token issued with it, and an
+// access token from before the last rotation still points at an older token of the same family.
+func SessionIDForAccessToken(userID uuid.UUID, accessTokenID string) (uuid.UUID, error) {
+	var dbToken models.RefreshToken
+	if err := helpers.DB().Where("access_token_id = ? AND user_id = ? AND client_id = ''", accessTokenID, userID).
+		First(&dbToken).Error; err != nil {
+		return uuid.Nil, ErrSessionNotFound
+	}
+	return dbToken.FamilyID, nil
+}
+
+// RevokeSession logs one session out by revoking every token in its family, and denylists
+// the access tokens handed out with them so the session dies now, not when they expire.
+// The userID check makes sure nobody can revoke a session of another user by guessing ids.
+func RevokeSession(userID uuid.UUID, sessionID uuid.UUID) error {
+	tx := helpers.DB().Begin()
+
+	result := tx.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND family_id = ? AND is_revoked = ?", userID, sessionID, false).
+		Update("is_revoked", true)
+	if result.Error != nil {
+		tx.Rollback()
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return ErrSessionNotFound
+	}
+
+	revoked, err := revokeSessionAccessTokens(tx, "user_id = ? AND family_id = ?", userID, sessionID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	rememberRevoked(revoked)
+	return nil
+}
+
+// RevokeOtherSessions logs a user out everywhere except keepSessionID.
+// Pass uuid.Nil to revoke every session. It returns how many sessions were ended.
+func RevokeOtherSessions(userID uuid.UUID, keepSessionID uuid.UUID) (int64, error) {
+	tx := helpers.DB().Begin()
+
+	sessionCount, revoked, err := revokeSessions(tx, userID, keepSessionID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+	rememberRevoked(revoked)
+	return sessionCount, nil
+}
+
+// revokeSessions is RevokeOtherSessions inside a caller's transaction. Pass the returned
+// access tokens to rememberRevoked after tx commits.
+func revokeSessions(tx *gorm.DB, userID uuid.UUID, keepSessionID uuid.UUID) (int64, []models.RevokedAccessToken, error) {
+	condition := "user_id = ?"
+	args := []interface{}{userID}
+	if keepSessionID != uuid.Nil {
+		condition += " AND family_id <> ?"
+		args = append(args, keepSessionID)
+	}
+
+	var sessionCount int64
+	if err := tx.Model(&models.RefreshToken{}).
+		Where(condition, args...).
+		Where("is_revoked = ? AND expires_at > ?", false, time.Now()).
+		Distinct("family_id").Count(&sessionCount).Error; err != nil {
+		return 0, nil, err
+	}
+
+	if err := tx.Model(&models.RefreshToken{}).
+		Where(condition, args...).
+		Where("is_revoked = ?", false).
+		Update("is_revoked", true).Error; err != nil {
+		return 0, nil, err
+	}
+
+	revoked, err := revokeSessionAccessTokens(tx, condition, args...)
+	if err != nil {
+		return 0, nil, err
+	}
+	return sessionCount, revoked, nil
+}
+
+func latest(a time.Time, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
@@ -1,14 +1,20 @@
 package repositories
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
-	"fmt"
+	"errors"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/amanguptak/fiber-api/config"
 	"github.com/amanguptak/fiber-api/helpers"
 	"github.com/amanguptak/fiber-api/models"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 func HashToken(token string) string {
@@ -17,57 +23,205 @@ func HashToken(token string) string {
 
 }
 
-func StoreRefreshToken(userID uuid.UUID, token string, expiresAt time.Time) error {
+// newOpaqueToken returns a random URL-safe token for links we email (password reset, ...).
+// Unlike a JWT it carries no data: the database row its hash points to is the whole truth.
+func newOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+var (
+	ErrTokenNotFound = errors.New("refresh token not found")
+	ErrTokenRevoked  = errors.New("refresh token revoked or expired")
+	ErrTokenReuse    = errors.New("token reuse detected")
+	ErrInvalidScope  = errors.New("requested scope exceeds the granted scope")
+)
+
+// ClientInfo identifies the caller that presents a refresh token.
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+}
+
+// AccessTokenRef names the access token issued together with a refresh token,
+// so revoking the session can denylist it too.
+type AccessTokenRef struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+// StoreRefreshToken saves the first refresh token of a login, which starts a new family (session).
+func StoreRefreshToken(userID uuid.UUID, token string, expiresAt time.Time, access AccessTokenRef, client ClientInfo) error {
 	refreshToken := models.RefreshToken{
-		UserID:    userID,
-		TokenHash: HashToken(token),
-		ExpiresAt: expiresAt,
+		UserID:               userID,
+		TokenHash:            HashToken(token),
+		ExpiresAt:            expiresAt,
+		IPAddress:            client.IPAddress,
+		UserAgent:            client.UserAgent,
+		AccessTokenID:        access.ID,
+		AccessTokenExpiresAt: &access.ExpiresAt,
 	}
 
 	return helpers.DB().Create(&refreshToken).Error
 }
 
-func RotateRefreshToken(oldTokenString string) (string, string, error) {
+// TokenGrant is the result of a rotation: the new pair, and the scopes of the access token.
+type TokenGrant struct {
+	AccessToken  string
+	RefreshToken string
+	Scopes       []string
+}
+
+// RotateRefreshToken exchanges a valid refresh token for a new access/refresh pair in the same family.
+//
+// If the token was already rotated, someone is replaying it. That kills the token's family (and only
+// that family, so the user's other devices stay logged in) and records a TokenReuseEvent.
+// The one exception is a replay from the same client within config.App.RefreshReuseGrace: two tabs
+// refreshing at the same moment both send the old cookie, and that is a race, not theft.
+func RotateRefreshToken(oldTokenString string, client ClientInfo) (string, string, error) {
+	grant, err := rotateRefreshToken(oldTokenString, client, "", nil)
+	return grant.AccessToken, grant.RefreshToken, err
+}
+
+// rotateRefreshToken is RotateRefreshToken for the refresh tokens of one OAuth client
+// (oauthClientID "" means those of logins). A token of anyone else counts as not found, so
+// one client cannot use, or set off reuse detection on, another's tokens. scopes, if not nil,
+// narrows the new access token (RFC 6749 section 6); the refresh token keeps its full scope.
+func rotateRefreshToken(oldTokenString string, client ClientInfo, oauthClientID string, scopes []string) (TokenGrant, error) {
 	tx := helpers.DB().Begin()
 	var dbToken models.RefreshToken
 	hash := HashToken(oldTokenString)
-	if err := tx.Where("token_hash = ?", hash).First(&dbToken).Error; err != nil {
+	if err := tx.Where("token_hash = ? AND client_id = ?", hash, oauthClientID).First(&dbToken).Error; err != nil {
+		tx.Rollback()
+		return TokenGrant{}, ErrTokenNotFound
+	}
+
+	granted := strings.Fields(dbToken.Scope)
+	if scopes == nil {
+		scopes = granted
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			tx.Rollback()
+			return TokenGrant{}, ErrInvalidScope
+		}
+	}
+
+	now := time.Now()
+	if now.After(dbToken.ExpiresAt) {
 		tx.Rollback()
-		return "", "", err // ✅ Return 2 empty strings
+		return TokenGrant{}, ErrTokenRevoked
 	}
 
 	if dbToken.IsRevoked {
-		tx.Model(&models.RefreshToken{}).Where("user_id=?", dbToken.UserID).Update("is_revoked", true)
-		tx.Commit()
-		return "", "", fmt.Errorf("token reuse detected")
+		if dbToken.RotatedAt == nil {
+			// Revoked by logout or a family kill, not by rotation: just refuse it.
+			tx.Rollback()
+			return TokenGrant{}, ErrTokenRevoked
+		}
+
+		if !withinReuseGrace(tx, dbToken, client, now) {
+			tx.Model(&models.RefreshToken{}).Where("family_id = ?", dbToken.FamilyID).Update("is_revoked", true)
+			// The thief may already hold an access token from this family: kill those as well.
+			revoked, _ := revokeSessionAccessTokens(tx, "family_id = ?", dbToken.FamilyID)
+			tx.Create(&models.TokenReuseEvent{
+				UserID:    dbToken.UserID,
+				FamilyID:  dbToken.FamilyID,
+				TokenID:   dbToken.ID,
+				IPAddress: client.IPAddress,
+				UserAgent: client.UserAgent,
+			})
+			if tx.Commit().Error == nil {
+				rememberRevoked(revoked)
+			}
+			return TokenGrant{}, ErrTokenReuse
+		}
+		// Inside the grace window: fall through and issue another child of the same parent.
+	} else {
+		dbToken.IsRevoked = true
+		dbToken.RotatedAt = &now
+		tx.Save(&dbToken)
+	}
+
+	// Load the user so the new tokens carry the CURRENT role (it may have changed since login).
+	var user models.User
+	if err := tx.Where("id = ?", dbToken.UserID).First(&user).Error; err != nil {
+		tx.Rollback()
+		return TokenGrant{}, err
 	}
 
-	dbToken.IsRevoked = true
-	tx.Save(&dbToken)
 	// ✅ Generate NEW Access Token (15 mins)
-	newAccessToken, err := helpers.GenerateToken(dbToken.UserID.String(), time.Now().Add(15*time.Minute))
+	newAccessToken, accessClaims, err := helpers.IssueClientToken(helpers.AccessToken, user.ID.String(), string(user.Role), dbToken.ClientID, scopes, time.Now().Add(config.App.AccessTokenTTL))
 	if err != nil {
 		tx.Rollback()
-		return "", "", err
+		return TokenGrant{}, err
 	}
 
 	// ✅ Generate NEW Refresh Token (7 days)
-	newRefreshToken, err := helpers.GenerateToken(dbToken.UserID.String(), time.Now().Add(7*24*time.Hour))
+	refreshExpiresAt := time.Now().Add(config.App.RefreshTokenTTL)
+	newRefreshToken, err := helpers.GenerateToken(helpers.RefreshToken, user.ID.String(), string(user.Role), refreshExpiresAt)
 	if err != nil {
 		tx.Rollback()
-		return "", "", err
+		return TokenGrant{}, err
 	}
 	newDbToken := models.RefreshToken{
 		UserID:    dbToken.UserID,
 		TokenHash: HashToken(newRefreshToken), // ✅ Hash the REFRESH token
-		ExpiresAt: time.Now().Add(7 * 24 * time.Hour),
+		ExpiresAt: refreshExpiresAt,
+		FamilyID:  dbToken.FamilyID, // ✅ Same session, one generation further
+		ParentID:  &dbToken.ID,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+
+		AccessTokenID:        accessClaims.ID,
+		AccessTokenExpiresAt: &accessClaims.ExpiresAt.Time,
+
+		ClientID: dbToken.ClientID,
+		Scope:    dbToken.Scope,
 	}
 	if err := tx.Create(&newDbToken).Error; err != nil {
 		tx.Rollback()
-		return "", "", err 
+		return TokenGrant{}, err
 	}
 	tx.Commit() // Save everything
-	return newAccessToken, newRefreshToken, nil
+	return TokenGrant{AccessToken: newAccessToken, RefreshToken: newRefreshToken, Scopes: scopes}, nil
+}
+
+// withinReuseGrace reports whether replaying an already-rotated token is a harmless race:
+// it was rotated moments ago, by the same client (IP and user agent of its child), and the
+// family is still alive (not logged out or already killed).
+func withinReuseGrace(tx *gorm.DB, rotated models.RefreshToken, client ClientInfo, now time.Time) bool {
+	grace := config.App.RefreshReuseGrace
+	if grace <= 0 || now.Sub(*rotated.RotatedAt) > grace {
+		return false
+	}
+
+	var child models.RefreshToken
+	if err := tx.Where("parent_id = ?", rotated.ID).Order("created_at asc").First(&child).Error; err != nil {
+		return false
+	}
+	if child.IPAddress != client.IPAddress || child.UserAgent != client.UserAgent {
+		return false
+	}
+
+	var alive int64
+	tx.Model(&models.RefreshToken{}).Where("family_id = ? AND is_revoked = ?", rotated.FamilyID, false).Count(&alive)
+	return alive > 0
+}
+
+// PurgeRefreshTokens deletes refresh tokens that can never be used again: every token past its
+// ExpiresAt, and revoked tokens whose revocation (rotation, or creation if it was revoked without
+// rotating) is older than retention. Revoked tokens are kept for a while on purpose: a replayed
+// rotated token is only recognised as reuse while its row still exists.
+func PurgeRefreshTokens(now time.Time, retention time.Duration) (int64, error) {
+	result := helpers.DB().
+		Where("expires_at < ?", now).
+		Or("is_revoked = ? AND COALESCE(rotated_at, created_at) < ?", true, now.Add(-retention)).
+		Delete(&models.RefreshToken{})
+	return result.RowsAffected, result.Error
 }
 
 /// ********** explaination of above function line by line  in token_repository.md---------
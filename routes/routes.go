@@ -3,21 +3,90 @@ package routes
 
 
 import (
+    "github.com/amanguptak/fiber-api/auth"
     "github.com/amanguptak/fiber-api/handlers"
     "github.com/amanguptak/fiber-api/middleware"
+    "github.com/amanguptak/fiber-api/models"
     "github.com/gofiber/fiber/v2"
 )
 
 func SetupRoutes(app *fiber.App) {
     // Public routes (no authentication required)
+    app.Get("/.well-known/jwks.json", handlers.JWKS)
     app.Post("/api/register", handlers.Register)
     app.Post("/api/login", handlers.Login)
-    app.Post("/api/logout", handlers.Logout)
-    app.Post("/api/refresh", handlers.Refresh)
+    app.Post("/api/login/mfa", handlers.VerifyMFA)
+    // The refresh cookie authenticates these two, so they only accept requests from our own pages.
+    // Breaking change: they were /api/refresh and /api/logout, which cannot get the cookie (path
+    // /api/auth) and are gone; see newplan.md.
+    app.Post("/api/auth/logout", middleware.RequireTrustedOrigin, handlers.Logout)
+    app.Post("/api/auth/refresh", middleware.RequireTrustedOrigin, handlers.Refresh)
+    app.Post("/api/forgot-password", handlers.ForgotPassword)
+    app.Post("/api/reset-password", handlers.ResetPassword)
+    app.Post("/api/magic-link", handlers.SendMagicLink)
+    app.Post("/api/magic-link/consume", handlers.ConsumeMagicLink)
+    app.Post("/api/verify-email", handlers.VerifyEmail)
+    app.Post("/api/verify-email/resend", handlers.ResendVerification)
+    app.Get("/api/oidc/login", handlers.OIDCLogin)
+    app.Get("/api/oidc/callback", handlers.OIDCCallback)
+    // OAuth 2.0 endpoints for registered clients, which authenticate with their own credentials.
+    app.Post("/oauth/token", handlers.OAuthToken)
+    app.Post("/oauth/introspect", handlers.OAuthIntrospect)
+    app.Post("/oauth/revoke", handlers.OAuthRevoke)
+    app.Get("/api/products", handlers.GetProducts)
+    app.Get("/api/products/:id", handlers.GetProduct)
 
     // Protected routes (authentication required)
     api := app.Group("/api", middleware.IsAuthenticated)
-    api.Get("/users/:id", handlers.GetUser)
-    api.Patch("/users/:id", handlers.UpdateUser)
-    api.Delete("/users/:id", handlers.DeleteUser)
+    adminOnly := middleware.RequireRole(models.RoleAdmin)
+    selfOrAdmin := middleware.RequireSelfOrAdmin("id")
+    // API keys and OAuth client tokens only reach what their scopes allow; logins (no scope list) pass every check.
+    profileRead := middleware.RequireScope(auth.ScopeProfileRead)
+    profileWrite := middleware.RequireScope(auth.ScopeProfileWrite)
+    ordersRead := middleware.RequireScope(auth.ScopeOrdersRead)
+    ordersWrite := middleware.RequireScope(auth.ScopeOrdersWrite)
+    productsWrite := middleware.RequireScope(auth.ScopeProductsWrite)
+    // Managing sessions, 2FA and API keys needs a real login, never an API key or client token.
+    loginOnly := middleware.RequireLogin
+
+    api.Get("/me", profileRead, handlers.GetMe)
+    api.Get("/users", adminOnly, handlers.GetUsers)
+    api.Get("/users/:id", profileRead, selfOrAdmin, handlers.GetUser)
+    api.Patch("/users/:id", profileWrite, selfOrAdmin, handlers.UpdateUser)
+    api.Delete("/users/:id", profileWrite, selfOrAdmin, handlers.DeleteUser)
+    api.Get("/users/:id/sessions", loginOnly, adminOnly, handlers.GetUserSessions)
+    api.Delete("/users/:id/sessions", loginOnly, adminOnly, handlers.RevokeUserSessions)
+    api.Delete("/users/:id/sessions/:sessionId", loginOnly, adminOnly, handlers.RevokeUserSession)
+    api.Get("/users/:id/api-keys", loginOnly, adminOnly, handlers.GetUserAPIKeys)
+    api.Post("/users/:id/api-keys", loginOnly, adminOnly, handlers.CreateUserAPIKey)
+    api.Delete("/users/:id/api-keys/:keyId", loginOnly, adminOnly, handlers.RevokeUserAPIKey)
+
+    api.Get("/service-accounts", adminOnly, handlers.GetServiceAccounts)
+    api.Post("/service-accounts", loginOnly, adminOnly, handlers.CreateServiceAccount)
+    api.Get("/oauth-clients", adminOnly, handlers.GetOAuthClients)
+    api.Post("/oauth-clients", loginOnly, adminOnly, handlers.CreateOAuthClient)
+    api.Delete("/oauth-clients/:id", loginOnly, adminOnly, handlers.RevokeOAuthClient)
+
+    api.Post("/mfa/totp/enroll", loginOnly, handlers.EnrollTOTP)
+    api.Post("/mfa/totp/confirm", loginOnly, handlers.ConfirmTOTP)
+    api.Post("/mfa/totp/disable", loginOnly, handlers.DisableTOTP)
+
+    api.Get("/sessions", loginOnly, handlers.GetSessions)
+    api.Post("/sessions/revoke-others", loginOnly, handlers.RevokeOtherSessions)
+    api.Delete("/sessions/:id", loginOnly, handlers.RevokeSession)
+
+    api.Get("/api-keys", loginOnly, handlers.GetAPIKeys)
+    api.Post("/api-keys", loginOnly, handlers.CreateAPIKey)
+    api.Delete("/api-keys/:id", loginOnly, handlers.RevokeAPIKey)
+
+    api.Get("/jobs", adminOnly, handlers.GetJobs)
+
+    api.Post("/products", productsWrite, adminOnly, handlers.CreateProduct)
+    api.Patch("/products/:id", productsWrite, adminOnly, handlers.UpdateProduct)
+    api.Delete("/products/:id", productsWrite, adminOnly, handlers.DeleteProduct)
+
+    api.Post("/orders", ordersWrite, middleware.RequireVerifiedEmail, handlers.CreateOrder)
+    api.Get("/orders", ordersRead, handlers.GetOrders)
+    api.Get("/orders/:id", ordersRead, handlers.GetOrder)
+    api.Patch("/orders/:id/status", ordersWrite, handlers.UpdateOrderStatus)
 }
\ No newline at end of file